@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"example.com/api/internal/auth"
+	"example.com/api/internal/setup"
+)
+
+func apiKey(args []string) error {
+	flags := flag.NewFlagSet("apikey", flag.ExitOnError)
+	setup.BindFlags(flags)
+	name := flags.String("name", "", "name of the API key, required with create and revoke")
+	scopes := flags.String("scopes", "", "comma separated scopes of the API key, for create")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: api apikey create|list|revoke [flags]")
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	action := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if (action == "create" || action == "revoke") && *name == "" {
+		return fmt.Errorf("--name is required")
+	}
+
+	initConfigErr := setup.InitializeConfig()
+	if initConfigErr != nil {
+		return initConfigErr
+	}
+	db := setup.GetConfig().PgPool
+
+	ctx := context.Background()
+	switch action {
+	case "create":
+		var scopeList []string
+		for _, scope := range strings.Split(*scopes, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopeList = append(scopeList, scope)
+			}
+		}
+		key, created, err := auth.CreateAPIKey(ctx, db, *name, scopeList)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created API key %s. Store it now, it cannot be shown again:\n%s\n", created.Name, key)
+		return nil
+	case "list":
+		keys, err := auth.ListAPIKeys(ctx, db)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tPREFIX\tSCOPES\tCREATED AT\tREVOKED AT")
+		for _, k := range keys {
+			revokedAt := "-"
+			if k.RevokedAt != nil {
+				revokedAt = k.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.Name, k.Prefix, strings.Join(k.Scopes, ","), k.CreatedAt.Format(time.RFC3339), revokedAt)
+		}
+		return w.Flush()
+	case "revoke":
+		if err := auth.RevokeAPIKey(ctx, db, *name); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked API key %s\n", *name)
+		return nil
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"example.com/api/internal/dataset"
+	"example.com/api/internal/setup"
+	"github.com/jackc/pgx/v5"
+)
+
+func seed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	setup.BindFlags(flags)
+	file := flags.String("file", "", "seed file in json (required)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("seed needs --file")
+	}
+
+	r, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	s, err := dataset.ReadSeed(r)
+	if err != nil {
+		return err
+	}
+
+	initConfigErr := setup.InitializeConfig()
+	if initConfigErr != nil {
+		return initConfigErr
+	}
+	pool, err := setup.GetConfig().PgxPool()
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	var result dataset.SeedResult
+	err = pgx.BeginFunc(context.Background(), pool, func(tx pgx.Tx) error {
+		result, err = dataset.ApplySeed(context.Background(), tx, s)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %d continents, %d countries and %d cities\n", result.Continents, result.Countries, result.Cities)
+	return nil
+}
+
+func export(args []string) (err error) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	setup.BindFlags(flags)
+	format := flags.String("format", dataset.FormatJSON, "output format, csv or json")
+	resource := flags.String("resource", dataset.ResourceAll, "continents, countries, cities or all (json only)")
+	output := flags.String("output", "", "output file (default stdout)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := dataset.ValidateFormat(*format, *resource); err != nil {
+		return err
+	}
+
+	// The export only reads, so it does not run the migrations.
+	loadErr := setup.LoadConfig()
+	if loadErr != nil {
+		return loadErr
+	}
+	pool, err := setup.GetConfig().PgxPool()
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	ds, err := dataset.Load(context.Background(), pool, *resource)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		// A failed close can lose the end of the file.
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		w = f
+	}
+
+	return dataset.Write(w, ds, *format, *resource)
+}
+
+func importData(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	setup.BindFlags(flags)
+	format := flags.String("format", dataset.FormatJSON, "input format, csv or json")
+	resource := flags.String("resource", dataset.ResourceAll, "continents, countries, cities or all (json only)")
+	file := flags.String("file", "", "input file (default stdin)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := dataset.ValidateFormat(*format, *resource); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ds, err := dataset.Read(r, *format, *resource)
+	if err != nil {
+		return err
+	}
+
+	initConfigErr := setup.InitializeConfig()
+	if initConfigErr != nil {
+		return initConfigErr
+	}
+	pool, err := setup.GetConfig().PgxPool()
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	err = pgx.BeginFunc(context.Background(), pool, func(tx pgx.Tx) error {
+		return dataset.Store(context.Background(), tx, ds)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d continents, %d countries and %d cities\n", len(ds.Continents), len(ds.Countries), len(ds.Cities))
+	return nil
+}
@@ -1,57 +1,56 @@
 package main
 
 import (
-	"context"
-	"log"
-	"net/http"
+	"fmt"
+	"log/slog"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
-
-	"example.com/api/internal/api"
-	"example.com/api/internal/setup"
+	"strings"
 )
 
-func main() {
-	initConfigErr := setup.InitializeConfig()
-	if initConfigErr != nil {
-		log.Fatalln(initConfigErr)
-	}
+const usage = `Usage: api [command] [flags]
 
-	api.InitializeRoutes()
+Commands:
+  serve                                   Run the HTTP server (default)
+  migrate up|down|status                  Manage the database schema
+  seed --file <file>                      Insert continents, countries and cities from a seed file
+  export --format csv|json                Write the atlas to stdout or a file
+  import --format csv|json --file <file>  Upsert the atlas from an exported file
+  apikey create|list|revoke               Manage the API keys
 
-	cfg := setup.GetConfig()
+Run 'api <command> -h' for the flags of a command.
+`
 
-	httpServer := &http.Server{
-		Addr:    "0.0.0.0:8080",
-		Handler: cfg.GinEngine,
+func main() {
+	command := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
 	}
-	errChan := make(chan error)
 
-	go func() {
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			errChan <- err
-		}
-	}()
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	select {
-	case err := <-errChan:
-		log.Printf("Server error: %v\n", err)
-	case sig := <-sigChan:
-		log.Printf("Received signal: %v\n", sig)
+	var err error
+	switch command {
+	case "serve":
+		err = serve(args)
+	case "migrate":
+		err = migrate(args)
+	case "seed":
+		err = seed(args)
+	case "export":
+		err = export(args)
+	case "import":
+		err = importData(args)
+	case "apikey":
+		err = apiKey(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s\n\n%s", command, usage)
+		os.Exit(2)
 	}
 
-	log.Println("Shutting down server...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := httpServer.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v\n", err)
+	if err != nil {
+		slog.Error("Command failed", "command", command, "error", err)
+		os.Exit(1)
 	}
-
-	log.Println("Server exiting")
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"example.com/api/internal/api"
+	"example.com/api/internal/metrics"
+	"example.com/api/internal/setup"
+	"example.com/api/internal/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	setup.BindFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	initConfigErr := setup.InitializeServerConfig()
+	if initConfigErr != nil {
+		return initConfigErr
+	}
+
+	cfg := setup.GetConfig()
+	if cfg.LogLevel.Value != "debug" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.TracingExporter.Value, cfg.TracingOtlpEndpoint.Value, cfg.TracingServiceName.Value)
+	if err != nil {
+		return err
+	}
+
+	api.InitializeRoutes()
+
+	pool, err := cfg.PgxPool()
+	if err != nil {
+		return err
+	}
+	if err := metrics.RegisterPool(pool); err != nil {
+		return err
+	}
+
+	// The request contexts derive from requestsCtx, so canceling it cancels
+	// the queries which are still running when the shutdown times out.
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	httpServer := &http.Server{
+		Addr:         cfg.ServerAddress.Value,
+		Handler:      cfg.GinEngine,
+		ReadTimeout:  cfg.ServerReadTimeout.Duration(),
+		WriteTimeout: cfg.ServerWriteTimeout.Duration(),
+		IdleTimeout:  cfg.ServerIdleTimeout.Duration(),
+		BaseContext:  func(net.Listener) context.Context { return requestsCtx },
+	}
+	errChan := make(chan error, 2)
+
+	slog.Info("Listening", "address", cfg.ServerAddress.Value)
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errChan <- err
+		}
+	}()
+
+	// The metrics and the health details are served on a separate listener,
+	// so they are not exposed with the API.
+	var adminServer *http.Server
+	if cfg.AdminAddress.Value != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/metrics", metrics.Handler())
+		adminMux.Handle("/health", api.HealthHandler())
+		adminServer = &http.Server{
+			Addr:              cfg.AdminAddress.Value,
+			Handler:           adminMux,
+			ReadHeaderTimeout: cfg.ServerReadTimeout.Duration(),
+		}
+
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errChan <- err
+			}
+		}()
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-errChan:
+		slog.Error("Server failed", "error", err)
+	case sig := <-sigChan:
+		slog.Info("Received signal", "signal", sig.String())
+
+		// Readiness fails first, so the load balancers stop sending
+		// requests before the listener is closed.
+		slog.Info("Draining", "delay", cfg.ShutdownDrainDelay.Value)
+		cfg.Health.Drain()
+		time.Sleep(cfg.ShutdownDrainDelay.Duration())
+	}
+
+	slog.Info("Shutting down server")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration())
+	defer cancel()
+
+	shutdownErr := httpServer.Shutdown(ctx)
+	if shutdownErr != nil {
+		cancelRequests()
+		httpServer.Close()
+		shutdownErr = fmt.Errorf("server forced to shutdown: %w", shutdownErr)
+	}
+	if adminServer != nil {
+		adminServer.Close()
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration())
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("Failed to flush the traces", "error", err)
+	}
+
+	slog.Info("Server exiting")
+	return shutdownErr
+}
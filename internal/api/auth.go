@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"example.com/api/internal/auth"
+	"example.com/api/internal/setup"
+	"github.com/gin-gonic/gin"
+)
+
+const principalKey = "principal"
+
+func newAuthenticators(cfg *setup.Config) []auth.Authenticator {
+	var authenticators []auth.Authenticator
+	modes := cfg.AuthMode.List()
+	if slices.Contains(modes, auth.ModeAPIKey) {
+		authenticators = append(authenticators, &auth.APIKeyAuthenticator{QueryRow: cfg.PgPool.QueryRow})
+	}
+	if slices.Contains(modes, auth.ModeJWT) {
+		authenticators = append(authenticators, &auth.JWTAuthenticator{
+			Issuer:   cfg.AuthJwtIssuer.Value,
+			Audience: cfg.AuthJwtAudience.Value,
+			JWKSURL:  cfg.AuthJwtJwksURL.Value,
+			Refresh:  cfg.AuthJwtJwksRefresh.Duration(),
+		})
+	}
+	return authenticators
+}
+
+// authenticate lets the request through when one of the authenticators
+// accepts its credentials, and stores the principal in the context.
+func authenticate(authenticators []auth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, authenticator := range authenticators {
+			principal, err := authenticator.Authenticate(c.Request.Context(), c.Request)
+			if errors.Is(err, auth.ErrNoCredentials) {
+				continue
+			}
+			if errors.Is(err, auth.ErrInvalidCredentials) {
+				requestLogger(c).Info("Authentication failed", "error", err)
+				writeUnauthorized(c, "The credentials are invalid")
+				return
+			}
+			var unavailable *auth.UnavailableError
+			if errors.As(err, &unavailable) {
+				requestLogger(c).Warn("Authentication unavailable", "error", err)
+				c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(unavailable.RetryAfter), 1)))
+				writeProblem(c, http.StatusServiceUnavailable, "The credentials cannot be checked now")
+				return
+			}
+			if err != nil {
+				writeDBError(c, err, "Credentials")
+				return
+			}
+
+			c.Set(principalKey, principal)
+			c.Next()
+			return
+		}
+
+		writeUnauthorized(c, "Authentication is required")
+	}
+}
+
+func writeUnauthorized(c *gin.Context, detail string) {
+	c.Header("WWW-Authenticate", `Bearer realm="atlas"`)
+	writeProblem(c, http.StatusUnauthorized, detail)
+}
+
+// principal returns the authenticated caller, or nil when the
+// authentication is off.
+func principal(c *gin.Context) *auth.Principal {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return nil
+	}
+	return value.(*auth.Principal)
+}
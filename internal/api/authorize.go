@@ -0,0 +1,196 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	scopeRead  = "atlas:read"
+	scopeWrite = "atlas:write"
+	scopeAdmin = "atlas:admin"
+	// scopeContinentWrite followed by a continent id grants writes to the
+	// countries and cities of that continent only.
+	scopeContinentWrite = "atlas:write:continent:"
+)
+
+// impliedScopes are granted together with a scope.
+var impliedScopes = map[string][]string{
+	scopeAdmin: {scopeWrite, scopeRead},
+	scopeWrite: {scopeRead},
+}
+
+// policy is the access rule of a route. The caller needs one of the
+// scopes, or, when the route resolves the continents which it touches, a
+// continent write scope for each of them.
+type policy struct {
+	scopes     []string
+	continents continentResolver
+}
+
+// continentResolver returns the ids of the continents which the request
+// reads or writes.
+type continentResolver func(c *gin.Context) ([]int, error)
+
+// authorize enforces the policy of a route. It lets every request through
+// when the authentication is off.
+func authorize(roleScopes map[string][]string, p policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		caller := principal(c)
+		if caller == nil {
+			c.Next()
+			return
+		}
+
+		granted := grantedScopes(caller.Scopes, caller.Roles, roleScopes)
+		for _, scope := range p.scopes {
+			if slices.Contains(granted, scope) {
+				c.Next()
+				return
+			}
+		}
+
+		if continents := continentGrants(granted); p.continents != nil && len(continents) > 0 {
+			ids, err := p.continents(c)
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				writeProblem(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must be at most %d bytes", maxBytesErr.Limit))
+				return
+			}
+			if err != nil {
+				writeDBError(c, err, "Resource")
+				return
+			}
+			if len(ids) > 0 && !slices.ContainsFunc(ids, func(id int) bool { return !slices.Contains(continents, id) }) {
+				c.Next()
+				return
+			}
+		}
+
+		writeProblem(c, http.StatusForbidden, "The credentials do not grant "+strings.Join(p.scopes, " or "))
+	}
+}
+
+// grantedScopes returns the scopes of the caller, the scopes mapped from its
+// roles, and the scopes which they imply.
+func grantedScopes(scopes []string, roles []string, roleScopes map[string][]string) []string {
+	granted := slices.Clone(scopes)
+	for _, role := range roles {
+		granted = append(granted, roleScopes[role]...)
+	}
+	for _, scope := range granted {
+		granted = append(granted, impliedScopes[scope]...)
+	}
+	slices.Sort(granted)
+	return slices.Compact(granted)
+}
+
+func continentGrants(scopes []string) []int {
+	var ids []int
+	for _, scope := range scopes {
+		if value, ok := strings.CutPrefix(scope, scopeContinentWrite); ok {
+			if id, err := strconv.Atoi(value); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// countryContinents resolves the continent of the country in the path, and
+// the continent_id of the request body.
+func countryContinents(queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row) continentResolver {
+	return func(c *gin.Context) ([]int, error) {
+		var ids []int
+		if id := c.Param("id"); id != "" {
+			var continentID int
+			if err := queryRowFunc(c.Request.Context(), "SELECT continent_id FROM countries WHERE id=$1", id).Scan(&continentID); err != nil {
+				return nil, err
+			}
+			ids = append(ids, continentID)
+		}
+
+		var input struct {
+			ContinentID int `json:"continent_id"`
+		}
+		ok, err := peekJSON(c, &input)
+		if err != nil {
+			return nil, err
+		}
+		if ok && input.ContinentID != 0 {
+			ids = append(ids, input.ContinentID)
+		}
+		return ids, nil
+	}
+}
+
+// cityContinents resolves the continent of the city in the path, or of the
+// country in the path for the nested routes, and the continent of the
+// country_id of the request body.
+func cityContinents(queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row, countryInPath bool) continentResolver {
+	return func(c *gin.Context) ([]int, error) {
+		var ids []int
+		if id := c.Param("id"); id != "" {
+			sql := "SELECT co.continent_id FROM cities ci JOIN countries co ON co.id = ci.country_id WHERE ci.id=$1"
+			if countryInPath {
+				sql = "SELECT continent_id FROM countries WHERE id=$1"
+			}
+			var continentID int
+			if err := queryRowFunc(c.Request.Context(), sql, id).Scan(&continentID); err != nil {
+				return nil, err
+			}
+			ids = append(ids, continentID)
+		}
+
+		var input struct {
+			CountryID int `json:"country_id"`
+		}
+		if countryInPath {
+			return ids, nil
+		}
+		ok, err := peekJSON(c, &input)
+		if err != nil {
+			return nil, err
+		}
+		if ok && input.CountryID != 0 {
+			var continentID int
+			err := queryRowFunc(c.Request.Context(), "SELECT continent_id FROM countries WHERE id=$1", input.CountryID).Scan(&continentID)
+			// A country which does not exist resolves no continent, so the
+			// request is only let through with a global scope.
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return nil, err
+			}
+			if err == nil {
+				ids = append(ids, continentID)
+			}
+		}
+		return ids, nil
+	}
+}
+
+// peekJSON decodes the request body into v, and restores the body for the
+// handler. The body is read up to the largest body of the API, the
+// boundary, and a longer body is an error rather than an unknown
+// continent, so that the handler cannot see a body which was not checked.
+func peekJSON(c *gin.Context, v any) (bool, error) {
+	if c.Request.Body == nil {
+		return false, nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBoundaryBytes))
+	if err != nil {
+		return false, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return json.Unmarshal(body, v) == nil, nil
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"example.com/api/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+var corsAllowedMethods = strings.Join([]string{
+	http.MethodGet,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodDelete,
+	http.MethodOptions,
+}, ", ")
+
+var corsAllowedHeaders = strings.Join([]string{"Authorization", "Content-Type", auth.APIKeyHeader, requestIDHeader}, ", ")
+
+// corsExposedHeaders are the response headers which the scripts can read,
+// besides the ones which are always exposed.
+var corsExposedHeaders = strings.Join([]string{
+	"Location",
+	"Retry-After",
+	"RateLimit-Limit",
+	"RateLimit-Remaining",
+	"RateLimit-Reset",
+	requestIDHeader,
+}, ", ")
+
+// cors allows browsers on the given origins to call the API. The origin
+// "*" allows every origin.
+func cors(allowedOrigins []string) gin.HandlerFunc {
+	allowAll := slices.Contains(allowedOrigins, "*")
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || (!allowAll && !slices.Contains(allowedOrigins, origin)) {
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Expose-Headers", corsExposedHeaders)
+		c.Header("Vary", "Origin")
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", corsAllowedMethods)
+			c.Header("Access-Control-Allow-Headers", corsAllowedHeaders)
+			c.Header("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/api/internal/geo"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+type Distance struct {
+	From              City    `json:"from"`
+	To                City    `json:"to"`
+	DistanceKm        float64 `json:"distance_km"`
+	DistanceMiles     float64 `json:"distance_miles"`
+	InitialBearingDeg float64 `json:"initial_bearing_deg"`
+	// TimeZoneOffsetHours is the offset of To minus the offset of From at
+	// the time of the request. It is null if either has no time zone.
+	TimeZoneOffsetHours *float64 `json:"time_zone_offset_difference_hours"`
+}
+
+type DistanceMatrix struct {
+	Cities []City `json:"cities"`
+	// DistancesKm[i][j] is the distance from Cities[i] to Cities[j].
+	DistancesKm [][]float64 `json:"distances_km"`
+}
+
+// getCityDistance returns the great-circle distance and the bearing from
+// the city id to the city otherId.
+func getCityDistance(queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ids, err := parseIDs([]string{c.Param("id"), c.Param("otherId")})
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		cities, ok := loadLocatedCities(c, queryFunc, ids)
+		if !ok {
+			return
+		}
+
+		from, to := cities[0], cities[1]
+		a, b := cityPoint(from), cityPoint(to)
+		km := geo.DistanceKm(a, b)
+		c.JSON(http.StatusOK, Distance{
+			From:                from,
+			To:                  to,
+			DistanceKm:          km,
+			DistanceMiles:       geo.KmToMiles(km),
+			InitialBearingDeg:   geo.InitialBearing(a, b),
+			TimeZoneOffsetHours: offsetDifferenceHours(from.TimeZone, to.TimeZone, time.Now()),
+		})
+	}
+}
+
+// getDistanceMatrix returns the pairwise distances of the cities in the
+// ids parameter, in the order of the ids.
+func getDistanceMatrix(queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error), maxCities int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		param := c.Query("ids")
+		if param == "" {
+			writeProblem(c, http.StatusBadRequest, "ids must be a comma separated list of city ids")
+			return
+		}
+		ids, err := parseIDs(strings.Split(param, ","))
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(ids) > maxCities {
+			writeProblem(c, http.StatusBadRequest, fmt.Sprintf("ids can have at most %d cities", maxCities))
+			return
+		}
+
+		cities, ok := loadLocatedCities(c, queryFunc, ids)
+		if !ok {
+			return
+		}
+
+		matrix := DistanceMatrix{Cities: cities, DistancesKm: make([][]float64, len(cities))}
+		for i := range cities {
+			matrix.DistancesKm[i] = make([]float64, len(cities))
+			for j := range i {
+				km := geo.DistanceKm(cityPoint(cities[i]), cityPoint(cities[j]))
+				matrix.DistancesKm[i][j] = km
+				matrix.DistancesKm[j][i] = km
+			}
+		}
+		c.JSON(http.StatusOK, matrix)
+	}
+}
+
+func parseIDs(params []string) ([]int, error) {
+	ids := make([]int, len(params))
+	for i, param := range params {
+		id, err := strconv.Atoi(strings.TrimSpace(param))
+		if err != nil {
+			return nil, fmt.Errorf("city id '%s' must be an integer", param)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// loadLocatedCities returns the cities in the order of ids, or writes an
+// error response if a city does not exist or has no coordinates.
+func loadLocatedCities(c *gin.Context, queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error), ids []int) ([]City, bool) {
+	rows, err := queryFunc(c.Request.Context(), "SELECT "+cityColumns+" FROM cities WHERE id = ANY($1)", ids)
+	if err != nil {
+		writeDBError(c, err, "City")
+		return nil, false
+	}
+	defer rows.Close()
+
+	found := map[int]City{}
+	for rows.Next() {
+		var city City
+		if err := rows.Scan(city.scanTargets()...); err != nil {
+			writeDBError(c, err, "City")
+			return nil, false
+		}
+		found[city.ID] = city
+	}
+	if err := rows.Err(); err != nil {
+		writeDBError(c, err, "City")
+		return nil, false
+	}
+
+	cities := make([]City, len(ids))
+	for i, id := range ids {
+		city, ok := found[id]
+		if !ok {
+			writeProblem(c, http.StatusNotFound, fmt.Sprintf("City %d not found", id))
+			return nil, false
+		}
+		if city.Latitude == nil || city.Longitude == nil {
+			writeProblem(c, http.StatusUnprocessableEntity, fmt.Sprintf("City %d has no coordinates", id))
+			return nil, false
+		}
+		cities[i] = city
+	}
+	return cities, true
+}
+
+func cityPoint(city City) geo.Point {
+	return geo.Point{Lat: *city.Latitude, Lon: *city.Longitude}
+}
+
+// offsetDifferenceHours is the UTC offset of the time zone to minus the
+// offset of from at the instant at, which changes with daylight saving.
+func offsetDifferenceHours(from, to *string, at time.Time) *float64 {
+	if from == nil || to == nil {
+		return nil
+	}
+	fromLocation, err := time.LoadLocation(*from)
+	if err != nil {
+		return nil
+	}
+	toLocation, err := time.LoadLocation(*to)
+	if err != nil {
+		return nil
+	}
+
+	_, fromOffset := at.In(fromLocation).Zone()
+	_, toOffset := at.In(toLocation).Zone()
+	hours := float64(toOffset-fromOffset) / 3600
+	return &hours
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	pgForeignKeyViolation       = "23503"
+	pgUniqueViolation           = "23505"
+	pgCheckViolation            = "23514"
+	pgInvalidTextRepresentation = "22P02"
+	pgNumericValueOutOfRange    = "22003"
+	pgQueryCanceled             = "57014"
+)
+
+// The capital must be a city of the country, so it is checked by a
+// composite foreign key from countries to cities.
+const capitalConstraint = "countries_capital_city_id_fkey"
+
+// writeDBError translates a database error into a problem response.
+// The resource names what was not found when the statement found no row.
+func writeDBError(c *gin.Context, err error, resource string) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeProblem(c, http.StatusNotFound, resource+" not found")
+		return
+	}
+
+	var pgErr *pgconn.PgError
+	isPgErr := errors.As(err, &pgErr)
+
+	// The statement timeout cancels the query through the request context,
+	// and the server cancels it when its own statement_timeout is reached.
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) || (isPgErr && pgErr.Code == pgQueryCanceled) {
+		writeProblem(c, http.StatusGatewayTimeout, "The database did not respond in time")
+		return
+	}
+	// The client went away or the server is shutting down.
+	if errors.Is(err, context.Canceled) {
+		writeProblem(c, http.StatusServiceUnavailable, "The request was canceled")
+		return
+	}
+
+	if !isPgErr {
+		writeInternalError(c, err)
+		return
+	}
+
+	switch pgErr.Code {
+	case pgForeignKeyViolation:
+		// A delete fails when the row is still referenced, any other write
+		// fails when it references a row which does not exist.
+		if c.Request.Method == http.MethodDelete {
+			writeProblem(c, http.StatusConflict, resource+" is still referenced by "+pgErr.TableName)
+			return
+		}
+		if pgErr.ConstraintName == capitalConstraint {
+			writeCapitalError(c, resource)
+			return
+		}
+		problem := newProblem(c, http.StatusUnprocessableEntity, "Referenced resource does not exist")
+		problem.Errors = []FieldError{{Field: constraintField(pgErr), Message: "references a resource which does not exist"}}
+		writeProblemResponse(c, problem)
+	case pgUniqueViolation:
+		problem := newProblem(c, http.StatusConflict, resource+" already exists")
+		problem.Errors = []FieldError{{Field: constraintField(pgErr), Message: "must be unique"}}
+		writeProblemResponse(c, problem)
+	case pgCheckViolation:
+		problem := newProblem(c, http.StatusUnprocessableEntity, resource+" is invalid")
+		problem.Errors = []FieldError{{Field: constraintField(pgErr), Message: "is invalid"}}
+		writeProblemResponse(c, problem)
+	case pgInvalidTextRepresentation:
+		writeProblem(c, http.StatusBadRequest, "A parameter has an invalid format")
+	case pgNumericValueOutOfRange:
+		// For example an id in the path which does not fit an integer column.
+		writeProblem(c, http.StatusBadRequest, "A parameter is out of range")
+	default:
+		writeInternalError(c, err)
+	}
+}
+
+// writeCapitalError explains a write which breaks the capital of a country.
+// A country can only have a city of its own as the capital, and a capital
+// cannot move to another country.
+func writeCapitalError(c *gin.Context, resource string) {
+	if resource == "Country" {
+		problem := newProblem(c, http.StatusUnprocessableEntity, "Capital is not a city of the country")
+		problem.Errors = []FieldError{{Field: "capital_city_id", Message: "must be a city of the country"}}
+		writeProblemResponse(c, problem)
+		return
+	}
+	writeProblem(c, http.StatusConflict, "City is the capital of its country, clear the capital_city_id of the country before moving the city")
+}
+
+// constraintField returns the column of a constraint which follows the
+// default PostgreSQL naming, for example countries_continent_id_fkey.
+func constraintField(pgErr *pgconn.PgError) string {
+	if pgErr.ColumnName != "" {
+		return pgErr.ColumnName
+	}
+	field := strings.TrimPrefix(pgErr.ConstraintName, pgErr.TableName+"_")
+	for _, suffix := range []string{"_fkey", "_key", "_check"} {
+		field = strings.TrimSuffix(field, suffix)
+	}
+	return field
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const maxExpandDepth = 2
+
+var countryExpands = map[string]bool{
+	"continent": true,
+}
+
+var cityExpands = map[string]bool{
+	"country":           true,
+	"country.continent": true,
+}
+
+// parseExpand validates the expand query parameter. An expanded path
+// implies its parents, so "country.continent" also expands "country".
+func parseExpand(c *gin.Context, allowed map[string]bool) (map[string]bool, error) {
+	expand := map[string]bool{}
+	param := c.Query("expand")
+	if param == "" {
+		return expand, nil
+	}
+
+	for _, path := range strings.Split(param, ",") {
+		path = strings.TrimSpace(path)
+		if strings.Count(path, ".")+1 > maxExpandDepth {
+			return nil, fmt.Errorf("expand path '%s' is deeper than %d levels", path, maxExpandDepth)
+		}
+		if !allowed[path] {
+			return nil, fmt.Errorf("cannot expand '%s'", path)
+		}
+		for i, r := range path {
+			if r == '.' {
+				expand[path[:i]] = true
+			}
+		}
+		expand[path] = true
+	}
+
+	return expand, nil
+}
+
+// expandCountries inlines the continents of the countries with one batched
+// lookup.
+func expandCountries(
+	ctx context.Context,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+	countries []*Country,
+	expand map[string]bool,
+) error {
+	if !expand["continent"] || len(countries) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(countries))
+	for _, country := range countries {
+		ids = append(ids, country.ContinentID)
+	}
+
+	continents, err := loadContinents(ctx, queryFunc, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, country := range countries {
+		country.Continent = continents[country.ContinentID]
+	}
+	return nil
+}
+
+// expandCities inlines the countries, and optionally their continents, of
+// the cities with one batched lookup per level.
+func expandCities(
+	ctx context.Context,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+	cities []*City,
+	expand map[string]bool,
+) error {
+	if !expand["country"] || len(cities) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(cities))
+	for _, city := range cities {
+		ids = append(ids, city.CountryID)
+	}
+
+	countries, err := loadCountries(ctx, queryFunc, ids)
+	if err != nil {
+		return err
+	}
+
+	loaded := make([]*Country, 0, len(countries))
+	for _, country := range countries {
+		loaded = append(loaded, country)
+	}
+	if err := expandCountries(ctx, queryFunc, loaded, map[string]bool{"continent": expand["country.continent"]}); err != nil {
+		return err
+	}
+
+	for _, city := range cities {
+		city.Country = countries[city.CountryID]
+	}
+	return nil
+}
+
+func loadContinents(
+	ctx context.Context,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+	ids []int,
+) (map[int]*Continent, error) {
+	rows, err := queryFunc(ctx, "SELECT "+continentColumns+" FROM continents WHERE id = ANY($1)", ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	continents := map[int]*Continent{}
+	for rows.Next() {
+		var continent Continent
+		if err := rows.Scan(continent.scanTargets()...); err != nil {
+			return nil, err
+		}
+		continents[continent.ID] = &continent
+	}
+	return continents, rows.Err()
+}
+
+func loadCountries(
+	ctx context.Context,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+	ids []int,
+) (map[int]*Country, error) {
+	rows, err := queryFunc(ctx, "SELECT "+countryColumns+" FROM countries WHERE id = ANY($1)", ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	countries := map[int]*Country{}
+	for rows.Next() {
+		var country Country
+		if err := rows.Scan(country.scanTargets()...); err != nil {
+			return nil, err
+		}
+		countries[country.ID] = &country
+	}
+	return countries, rows.Err()
+}
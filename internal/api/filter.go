@@ -0,0 +1,212 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fieldKind int
+
+const (
+	intField fieldKind = iota
+	textField
+	floatField
+)
+
+type field struct {
+	column string
+	kind   fieldKind
+	// sort is the sort expression of a nullable column. It replaces null
+	// with a value which sorts first, because keyset pagination cannot
+	// compare null.
+	sort string
+}
+
+func (f field) sortExpr() string {
+	if f.sort != "" {
+		return f.sort
+	}
+	return f.column
+}
+
+// fields declares which query parameters a collection endpoint can be
+// filtered and sorted by. The key is the public field name.
+type fields map[string]field
+
+var filterOperators = map[string]string{
+	"":      "=",
+	"ne":    "<>",
+	"lt":    "<",
+	"lte":   "<=",
+	"gt":    ">",
+	"gte":   ">=",
+	"like":  "LIKE",
+	"ilike": "ILIKE",
+	"in":    "IN",
+}
+
+// reservedParams are query parameters which are not filters.
+var reservedParams = map[string]bool{
+	"limit":  true,
+	"cursor": true,
+	"sort":   true,
+	"expand": true,
+	"format": true,
+}
+
+type sortKey struct {
+	name string
+	field
+	desc bool
+}
+
+type listQuery struct {
+	columns string
+	from    string
+	where   []string
+	args    []any
+	order   []sortKey
+}
+
+func (q *listQuery) arg(value any) string {
+	q.args = append(q.args, value)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *listQuery) sql(limit int) string {
+	var b strings.Builder
+	b.WriteString("SELECT " + q.columns)
+	for _, key := range q.order {
+		b.WriteString(", " + key.sortExpr())
+	}
+	b.WriteString(" FROM " + q.from)
+	if len(q.where) > 0 {
+		b.WriteString(" WHERE " + strings.Join(q.where, " AND "))
+	}
+	b.WriteString(" ORDER BY ")
+	for i, key := range q.order {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(key.sortExpr())
+		if key.desc {
+			b.WriteString(" DESC")
+		}
+	}
+	b.WriteString(" LIMIT " + q.arg(limit))
+	return b.String()
+}
+
+func (q *listQuery) sortParam() string {
+	names := make([]string, len(q.order))
+	for i, key := range q.order {
+		names[i] = key.name
+		if key.desc {
+			names[i] = "-" + key.name
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// parseListQuery adds the filters and the sort order from the request's
+// query parameters into q. The id is always the last sort key so that the
+// order is stable for keyset pagination.
+func parseListQuery(c *gin.Context, allowed fields, q *listQuery) error {
+	params := c.Request.URL.Query()
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if reservedParams[name] {
+			continue
+		}
+
+		fieldName, op, _ := strings.Cut(name, "__")
+		f, ok := allowed[fieldName]
+		if !ok {
+			return fmt.Errorf("unknown filter field '%s'", fieldName)
+		}
+		sqlOp, ok := filterOperators[op]
+		if !ok {
+			return fmt.Errorf("unknown filter operator '%s' on field '%s'", op, fieldName)
+		}
+		if (op == "like" || op == "ilike") && f.kind != textField {
+			return fmt.Errorf("operator '%s' is not supported on field '%s'", op, fieldName)
+		}
+
+		for _, raw := range params[name] {
+			if op == "in" {
+				var placeholders []string
+				for _, item := range strings.Split(raw, ",") {
+					value, err := parseFieldValue(f, fieldName, item)
+					if err != nil {
+						return err
+					}
+					placeholders = append(placeholders, q.arg(value))
+				}
+				q.where = append(q.where, f.column+" IN ("+strings.Join(placeholders, ", ")+")")
+				continue
+			}
+
+			value, err := parseFieldValue(f, fieldName, raw)
+			if err != nil {
+				return err
+			}
+			q.where = append(q.where, f.column+" "+sqlOp+" "+q.arg(value))
+		}
+	}
+
+	return parseSort(c.Query("sort"), allowed, q)
+}
+
+func parseSort(param string, allowed fields, q *listQuery) error {
+	hasID := false
+	if param != "" {
+		names := strings.Split(param, ",")
+		for i, name := range names {
+			desc := strings.HasPrefix(name, "-")
+			name = strings.TrimPrefix(name, "-")
+			f, ok := allowed[name]
+			if !ok {
+				return fmt.Errorf("unknown sort field '%s'", name)
+			}
+			// The id is unique, so the fields after it would not sort.
+			if name == "id" && i < len(names)-1 {
+				return fmt.Errorf("id must be the last sort field")
+			}
+			q.order = append(q.order, sortKey{name: name, field: f, desc: desc})
+			hasID = hasID || name == "id"
+		}
+	}
+	if !hasID {
+		q.order = append(q.order, sortKey{name: "id", field: allowed["id"]})
+	}
+	return nil
+}
+
+func parseFieldValue(f field, name string, raw string) (any, error) {
+	switch f.kind {
+	case intField:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s' must be an integer", name)
+		}
+		return n, nil
+	case floatField:
+		n, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s' must be a number", name)
+		}
+		return n, nil
+	default:
+		return raw, nil
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"example.com/api/internal/geo"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	geoJSONContentType = "application/geo+json"
+	formatJSON         = "json"
+	formatGeoJSON      = "geojson"
+	maxBoundaryBytes   = 10 << 20
+)
+
+type Geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+type Feature struct {
+	Type       string    `json:"type"`
+	ID         int       `json:"id"`
+	Geometry   *Geometry `json:"geometry"`
+	Properties any       `json:"properties"`
+}
+
+type FeatureCollection struct {
+	Type       string    `json:"type"`
+	Features   []Feature `json:"features"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// responseFormat returns the format of the format parameter, or the one
+// negotiated with the Accept header. Only the endpoints with geoJSON
+// offer GeoJSON.
+func responseFormat(c *gin.Context, geoJSON bool) (string, error) {
+	if !geoJSON {
+		if format := c.Query("format"); format != "" && format != formatJSON {
+			return "", fmt.Errorf("format must be %s", formatJSON)
+		}
+		return formatJSON, nil
+	}
+
+	c.Writer.Header().Add("Vary", "Accept")
+	switch c.Query("format") {
+	case formatGeoJSON:
+		return formatGeoJSON, nil
+	case formatJSON:
+		return formatJSON, nil
+	case "":
+		if c.NegotiateFormat(gin.MIMEJSON, geoJSONContentType) == geoJSONContentType {
+			return formatGeoJSON, nil
+		}
+		return formatJSON, nil
+	default:
+		return "", fmt.Errorf("format must be %s or %s", formatJSON, formatGeoJSON)
+	}
+}
+
+func writeGeoJSON(c *gin.Context, status int, v any) {
+	c.Header("Content-Type", geoJSONContentType)
+	c.JSON(status, v)
+}
+
+// cityFeature is a Point feature, or a feature without a geometry when
+// the city has no coordinates.
+func cityFeature(city City, properties any) Feature {
+	feature := Feature{Type: "Feature", ID: city.ID, Properties: properties}
+	if city.Latitude != nil && city.Longitude != nil {
+		feature.Geometry = &Geometry{Type: "Point", Coordinates: geo.Position{*city.Longitude, *city.Latitude}}
+	}
+	return feature
+}
+
+func cityFeatures(cities []City) []Feature {
+	features := make([]Feature, len(cities))
+	for i, city := range cities {
+		features[i] = cityFeature(city, city)
+	}
+	return features
+}
+
+// parseBoundary decodes and validates a GeoJSON Polygon or MultiPolygon
+// geometry.
+func parseBoundary(data []byte) (*Geometry, error) {
+	geometryType, coordinates, err := geo.ParseBoundary(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Geometry{Type: geometryType, Coordinates: coordinates}, nil
+}
+
+func (g *Geometry) simplify(tolerance float64) *Geometry {
+	switch coordinates := g.Coordinates.(type) {
+	case geo.Polygon:
+		return &Geometry{Type: g.Type, Coordinates: coordinates.Simplify(tolerance)}
+	case geo.MultiPolygon:
+		return &Geometry{Type: g.Type, Coordinates: coordinates.Simplify(tolerance)}
+	default:
+		return g
+	}
+}
+
+func parseTolerance(c *gin.Context) (float64, error) {
+	param := c.Query("tolerance")
+	if param == "" {
+		return 0, nil
+	}
+	tolerance, err := strconv.ParseFloat(param, 64)
+	if err != nil || tolerance < 0 {
+		return 0, fmt.Errorf("tolerance must be a non-negative number of degrees")
+	}
+	return tolerance, nil
+}
+
+// readBoundary reads a boundary request body, or writes an error response.
+func readBoundary(c *gin.Context) (*Geometry, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBoundaryBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeProblem(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("boundary must be at most %d bytes", maxBoundaryBytes))
+			return nil, false
+		}
+		writeProblem(c, http.StatusBadRequest, "Request body could not be read")
+		return nil, false
+	}
+
+	boundary, err := parseBoundary(body)
+	if err != nil {
+		writeProblem(c, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return boundary, true
+}
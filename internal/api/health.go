@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"example.com/api/internal/setup"
+	"github.com/gin-gonic/gin"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+const (
+	statusUp       = "up"
+	statusDown     = "down"
+	statusStarting = "starting"
+	statusDraining = "draining"
+)
+
+type componentHealth struct {
+	Status    string         `json:"status"`
+	LatencyMs float64        `json:"latency_ms,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+type healthReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentHealth `json:"components,omitempty"`
+}
+
+// liveness only tells that the process is serving requests, so the
+// orchestrator does not restart it when a dependency is down.
+func liveness() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, healthReport{Status: statusUp})
+	}
+}
+
+// readiness fails while the server is starting or draining, or when a
+// dependency is down, so the load balancers send no requests to this
+// instance. It is public, so the errors are only logged.
+func readiness(health *setup.Health, checks []setup.HealthCheck) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if status := processStatus(health); status != statusUp {
+			c.JSON(http.StatusServiceUnavailable, healthReport{Status: status})
+			return
+		}
+
+		report := runHealthChecks(c.Request.Context(), checks)
+		for name, component := range report.Components {
+			if component.Error != "" {
+				requestLogger(c).Warn("Health check failed", "component", name, "error", component.Error)
+			}
+			component.LatencyMs = 0
+			component.Error = ""
+			report.Components[name] = component
+		}
+		c.JSON(healthStatusCode(report), report)
+	}
+}
+
+// HealthHandler serves the detailed health report on the admin listener,
+// because the errors show the database address and user.
+func HealthHandler() http.Handler {
+	cfg := setup.GetConfig()
+	engine := gin.New()
+	engine.Use(recovery())
+	engine.GET("/health", healthDetails(cfg.Health, cfg.HealthChecks()))
+	return engine
+}
+
+// healthDetails reports the status, latency and error of every dependency.
+func healthDetails(health *setup.Health, checks []setup.HealthCheck) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := runHealthChecks(c.Request.Context(), checks)
+		if status := processStatus(health); status != statusUp {
+			report.Status = status
+		}
+		c.JSON(healthStatusCode(report), report)
+	}
+}
+
+// requireStarted answers 503 until the database is connected and migrated
+// in the degraded mode.
+func requireStarted(health *setup.Health) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if health.Starting() {
+			c.Header("Retry-After", "5")
+			writeProblem(c, http.StatusServiceUnavailable, "The database is not available yet")
+			return
+		}
+		c.Next()
+	}
+}
+
+func processStatus(health *setup.Health) string {
+	switch {
+	case health.Draining():
+		return statusDraining
+	case health.Starting():
+		return statusStarting
+	default:
+		return statusUp
+	}
+}
+
+func runHealthChecks(ctx context.Context, checks []setup.HealthCheck) healthReport {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	report := healthReport{Status: statusUp, Components: map[string]componentHealth{}}
+	for _, check := range checks {
+		start := time.Now()
+		details, err := check.Check(ctx)
+		component := componentHealth{
+			Status:    statusUp,
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			Details:   details,
+		}
+		if err != nil {
+			component.Status = statusDown
+			component.Error = err.Error()
+			report.Status = statusDown
+		}
+		report.Components[check.Name] = component
+	}
+	return report
+}
+
+func healthStatusCode(report healthReport) int {
+	if report.Status != statusUp {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+)
+
+// validRequestID limits the ids which are taken from the clients, so they
+// cannot inject anything into the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestID takes the X-Request-ID of the request, or generates one, and
+// echoes it in the response.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = randomID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// requestLogger returns the default logger with the ids of the request.
+func requestLogger(c *gin.Context) *slog.Logger {
+	return slog.Default().With(requestIDKey, c.GetString(requestIDKey), traceIDKey, traceID(c))
+}
+
+// accessLog writes a line for every request. The server errors are logged
+// at the error level.
+func accessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []any{
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"size", max(c.Writer.Size(), 0),
+			"client_ip", c.ClientIP(),
+		}
+		if p := principal(c); p != nil {
+			attrs = append(attrs, "subject", p.Subject)
+		}
+		requestLogger(c).Log(c.Request.Context(), level, "Request", attrs...)
+	}
+}
+
+// recovery logs a panic with its stack trace, and writes a 500 response
+// which does not expose it to the client.
+func recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				requestLogger(c).Error("Panic", "error", fmt.Sprint(r), "stack", string(debug.Stack()))
+				if !c.Writer.Written() {
+					writeProblem(c, http.StatusInternalServerError, "An internal error occurred")
+				} else {
+					c.Abort()
+				}
+			}
+		}()
+		c.Next()
+	}
+}
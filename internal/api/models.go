@@ -0,0 +1,176 @@
+package api
+
+import (
+	"regexp"
+	"time"
+	// The image has no zoneinfo, and the time zones of the cities are
+	// validated and converted with the embedded database.
+	_ "time/tzdata"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	continentColumns = "id, name, created_at, updated_at"
+	countryColumns   = "id, name, continent_id, iso_alpha2, iso_alpha3, iso_numeric, official_name, capital_city_id, population, area_km2, calling_code, tld, created_at, updated_at"
+	cityColumns      = "id, name, country_id, latitude, longitude, elevation_m, population, time_zone, created_at, updated_at"
+)
+
+// The formats of the country fields which the validator does not know.
+var formats = map[string]*regexp.Regexp{
+	"calling_code": regexp.MustCompile(`^\+[0-9]{1,3}(-[0-9]{1,4})?$`),
+	"tld":          regexp.MustCompile(`^\.[a-z]{2,63}$`),
+}
+
+var (
+	isoAlpha2Pattern  = regexp.MustCompile(`^[A-Z]{2}$`)
+	isoAlpha3Pattern  = regexp.MustCompile(`^[A-Z]{3}$`)
+	isoNumericPattern = regexp.MustCompile(`^[0-9]{3}$`)
+)
+
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		for tag, pattern := range formats {
+			_ = v.RegisterValidation(tag, func(fl validator.FieldLevel) bool {
+				return pattern.MatchString(fl.Field().String())
+			})
+		}
+	}
+}
+
+type Continent struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Country struct {
+	ID            int        `json:"id"`
+	Name          string     `json:"name"`
+	ContinentID   int        `json:"continent_id"`
+	ISOAlpha2     *string    `json:"iso_alpha2"`
+	ISOAlpha3     *string    `json:"iso_alpha3"`
+	ISONumeric    *string    `json:"iso_numeric"`
+	OfficialName  *string    `json:"official_name"`
+	CapitalCityID *int       `json:"capital_city_id"`
+	Population    *int64     `json:"population"`
+	AreaKm2       *float64   `json:"area_km2"`
+	CallingCode   *string    `json:"calling_code"`
+	TLD           *string    `json:"tld"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Continent     *Continent `json:"continent,omitempty"`
+}
+
+type City struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	CountryID  int       `json:"country_id"`
+	Latitude   *float64  `json:"latitude"`
+	Longitude  *float64  `json:"longitude"`
+	ElevationM *int      `json:"elevation_m"`
+	Population *int64    `json:"population"`
+	TimeZone   *string   `json:"time_zone"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Country    *Country  `json:"country,omitempty"`
+}
+
+type ContinentInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CountryInput replaces all fields of a country, so the omitted optional
+// fields are cleared. The capital must be a city of the country.
+type CountryInput struct {
+	Name          string   `json:"name" binding:"required"`
+	ContinentID   int      `json:"continent_id" binding:"required"`
+	ISOAlpha2     *string  `json:"iso_alpha2" binding:"omitempty,iso3166_1_alpha2"`
+	ISOAlpha3     *string  `json:"iso_alpha3" binding:"omitempty,iso3166_1_alpha3"`
+	ISONumeric    *string  `json:"iso_numeric" binding:"omitempty,len=3,numeric,iso3166_1_alpha_numeric"`
+	OfficialName  *string  `json:"official_name" binding:"omitempty,max=200"`
+	CapitalCityID *int     `json:"capital_city_id" binding:"omitempty,min=1"`
+	Population    *int64   `json:"population" binding:"omitempty,min=0"`
+	AreaKm2       *float64 `json:"area_km2" binding:"omitempty,gt=0"`
+	CallingCode   *string  `json:"calling_code" binding:"omitempty,calling_code"`
+	TLD           *string  `json:"tld" binding:"omitempty,tld"`
+}
+
+// CityInput replaces all fields of a city. The latitude and the longitude
+// are given together, and the time zone is an IANA name such as
+// Europe/Helsinki.
+type CityInput struct {
+	Name       string   `json:"name" binding:"required"`
+	CountryID  int      `json:"country_id" binding:"required"`
+	Latitude   *float64 `json:"latitude" binding:"required_with=Longitude,omitempty,min=-90,max=90"`
+	Longitude  *float64 `json:"longitude" binding:"required_with=Latitude,omitempty,min=-180,max=180"`
+	ElevationM *int     `json:"elevation_m" binding:"omitempty,min=-500,max=9000"`
+	Population *int64   `json:"population" binding:"omitempty,min=0"`
+	TimeZone   *string  `json:"time_zone" binding:"omitempty,timezone"`
+}
+
+// countryInputColumns are the columns written from a CountryInput, in the
+// same order as its args.
+const countryInputColumns = "name, continent_id, iso_alpha2, iso_alpha3, iso_numeric, official_name, capital_city_id, population, area_km2, calling_code, tld"
+
+func (in CountryInput) args() []any {
+	return []any{in.Name, in.ContinentID, in.ISOAlpha2, in.ISOAlpha3, in.ISONumeric, in.OfficialName, in.CapitalCityID, in.Population, in.AreaKm2, in.CallingCode, in.TLD}
+}
+
+// cityInputColumns are the columns written from a CityInput, in the same
+// order as its args.
+const cityInputColumns = "name, country_id, latitude, longitude, elevation_m, population, time_zone"
+
+func (in CityInput) args() []any {
+	return []any{in.Name, in.CountryID, in.Latitude, in.Longitude, in.ElevationM, in.Population, in.TimeZone}
+}
+
+// The scan targets are in the same order as the matching columns constant.
+
+func (c *Continent) scanTargets() []any {
+	return []any{&c.ID, &c.Name, &c.CreatedAt, &c.UpdatedAt}
+}
+
+func (c *Country) scanTargets() []any {
+	return []any{
+		&c.ID, &c.Name, &c.ContinentID, &c.ISOAlpha2, &c.ISOAlpha3, &c.ISONumeric, &c.OfficialName,
+		&c.CapitalCityID, &c.Population, &c.AreaKm2, &c.CallingCode, &c.TLD, &c.CreatedAt, &c.UpdatedAt,
+	}
+}
+
+func (c *City) scanTargets() []any {
+	return []any{
+		&c.ID, &c.Name, &c.CountryID, &c.Latitude, &c.Longitude, &c.ElevationM, &c.Population, &c.TimeZone,
+		&c.CreatedAt, &c.UpdatedAt,
+	}
+}
+
+var continentFields = fields{
+	"id":   {column: "id", kind: intField},
+	"name": {column: "name", kind: textField},
+}
+
+var countryFields = fields{
+	"id":              {column: "id", kind: intField},
+	"name":            {column: "name", kind: textField},
+	"continent_id":    {column: "continent_id", kind: intField},
+	"iso_alpha2":      {column: "iso_alpha2", kind: textField, sort: "COALESCE(iso_alpha2, '')"},
+	"iso_alpha3":      {column: "iso_alpha3", kind: textField, sort: "COALESCE(iso_alpha3, '')"},
+	"iso_numeric":     {column: "iso_numeric", kind: textField, sort: "COALESCE(iso_numeric, '')"},
+	"capital_city_id": {column: "capital_city_id", kind: intField, sort: "COALESCE(capital_city_id, 0)"},
+	"population":      {column: "population", kind: intField, sort: "COALESCE(population, -1)"},
+	"area_km2":        {column: "area_km2", kind: floatField, sort: "COALESCE(area_km2, 0)"},
+}
+
+var cityFields = fields{
+	"id":          {column: "id", kind: intField},
+	"name":        {column: "name", kind: textField},
+	"country_id":  {column: "country_id", kind: intField},
+	"latitude":    {column: "latitude", kind: floatField, sort: "COALESCE(latitude, -91)"},
+	"longitude":   {column: "longitude", kind: floatField, sort: "COALESCE(longitude, -181)"},
+	"elevation_m": {column: "elevation_m", kind: intField, sort: "COALESCE(elevation_m, -501)"},
+	"population":  {column: "population", kind: intField, sort: "COALESCE(population, -1)"},
+	"time_zone":   {column: "time_zone", kind: textField, sort: "COALESCE(time_zone, '')"},
+}
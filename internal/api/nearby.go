@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/api/internal/geo"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	maxNearbyRadiusKm = 2000
+	// The nearest city is searched in growing circles, starting from this
+	// radius, until one is found or the circle covers the Earth.
+	nearestStartRadiusKm = 50
+	nearestRadiusGrowth  = 4
+)
+
+type NearbyCity struct {
+	City
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// getNearbyCities lists the cities within radius_km of lat and lon, the
+// nearest first.
+func getNearbyCities(queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expand, err := parseExpand(c, cityExpands)
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		format, err := responseFormat(c, true)
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		center, err := parsePoint(c)
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		radiusKm, err := strconv.ParseFloat(c.Query("radius_km"), 64)
+		if err != nil || radiusKm <= 0 || radiusKm > maxNearbyRadiusKm {
+			writeProblem(c, http.StatusBadRequest, fmt.Sprintf("radius_km must be a number greater than 0 and at most %d", maxNearbyRadiusKm))
+			return
+		}
+		limit, err := parseLimit(c)
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		cities, err := queryNearby(c.Request.Context(), queryFunc, center, radiusKm, limit)
+		if err != nil {
+			writeDBError(c, err, "City")
+			return
+		}
+		if err := expandNearby(c.Request.Context(), queryFunc, cities, expand); err != nil {
+			writeDBError(c, err, "City")
+			return
+		}
+		if format == formatGeoJSON {
+			features := make([]Feature, len(cities))
+			for i, city := range cities {
+				features[i] = cityFeature(city.City, city)
+			}
+			writeGeoJSON(c, http.StatusOK, FeatureCollection{Type: "FeatureCollection", Features: features})
+			return
+		}
+		c.JSON(http.StatusOK, pageResponse[NearbyCity]{Data: cities})
+	}
+}
+
+// getNearestCity returns the city nearest to lat and lon.
+func getNearestCity(queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expand, err := parseExpand(c, cityExpands)
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		format, err := responseFormat(c, true)
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		center, err := parsePoint(c)
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// Every city within the radius is in the bounding box, so the
+		// nearest of them is the nearest of all cities.
+		halfCircumference := math.Pi * geo.EarthRadiusKm
+		var cities []NearbyCity
+		for radiusKm := float64(nearestStartRadiusKm); len(cities) == 0; radiusKm *= nearestRadiusGrowth {
+			radiusKm = math.Min(radiusKm, halfCircumference)
+			cities, err = queryNearby(c.Request.Context(), queryFunc, center, radiusKm, 1)
+			if err != nil {
+				writeDBError(c, err, "City")
+				return
+			}
+			if radiusKm == halfCircumference {
+				break
+			}
+		}
+		if len(cities) == 0 {
+			writeProblem(c, http.StatusNotFound, "No city has coordinates")
+			return
+		}
+
+		if err := expandNearby(c.Request.Context(), queryFunc, cities, expand); err != nil {
+			writeDBError(c, err, "City")
+			return
+		}
+		if format == formatGeoJSON {
+			writeGeoJSON(c, http.StatusOK, cityFeature(cities[0].City, cities[0]))
+			return
+		}
+		c.JSON(http.StatusOK, cities[0])
+	}
+}
+
+func parsePoint(c *gin.Context) (geo.Point, error) {
+	lat, err := strconv.ParseFloat(c.Query("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return geo.Point{}, fmt.Errorf("lat must be a number between -90 and 90")
+	}
+	lon, err := strconv.ParseFloat(c.Query("lon"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return geo.Point{}, fmt.Errorf("lon must be a number between -180 and 180")
+	}
+	return geo.Point{Lat: lat, Lon: lon}, nil
+}
+
+// queryNearby finds the cities within radiusKm of center. The bounding
+// boxes use the index on the coordinates, and only the cities in them get
+// their distance computed.
+func queryNearby(
+	ctx context.Context,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+	center geo.Point,
+	radiusKm float64,
+	limit int,
+) ([]NearbyCity, error) {
+	var q listQuery
+	distance := distanceSQL(q.arg(center.Lat), q.arg(center.Lon))
+
+	var boxes []string
+	for _, box := range geo.BoundingBoxes(center, radiusKm) {
+		boxes = append(boxes, "(latitude BETWEEN "+q.arg(box.MinLat)+" AND "+q.arg(box.MaxLat)+
+			" AND longitude BETWEEN "+q.arg(box.MinLon)+" AND "+q.arg(box.MaxLon)+")")
+	}
+
+	sql := "SELECT " + cityColumns + ", distance_km FROM (SELECT " + cityColumns + ", " + distance + " AS distance_km FROM cities" +
+		" WHERE " + strings.Join(boxes, " OR ") + ") AS nearby" +
+		" WHERE distance_km <= " + q.arg(radiusKm) + " ORDER BY distance_km, id LIMIT " + q.arg(limit)
+
+	rows, err := queryFunc(ctx, sql, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cities := make([]NearbyCity, 0)
+	for rows.Next() {
+		var city NearbyCity
+		if err := rows.Scan(append(city.scanTargets(), &city.DistanceKm)...); err != nil {
+			return nil, err
+		}
+		cities = append(cities, city)
+	}
+	return cities, rows.Err()
+}
+
+// distanceSQL is the haversine distance in km from the coordinates of a
+// city to the given latitude and longitude placeholders. The least guards
+// asin against rounding above 1.
+func distanceSQL(lat, lon string) string {
+	return fmt.Sprintf("2 * %v * asin(least(1, sqrt(power(sin(radians(latitude - %s) / 2), 2)"+
+		" + cos(radians(%s)) * cos(radians(latitude)) * power(sin(radians(longitude - %s) / 2), 2))))",
+		geo.EarthRadiusKm, lat, lat, lon)
+}
+
+func expandNearby(
+	ctx context.Context,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+	nearby []NearbyCity,
+	expand map[string]bool,
+) error {
+	cities := make([]*City, len(nearby))
+	for i := range nearby {
+		cities[i] = &nearby[i].City
+	}
+	return expandCities(ctx, queryFunc, cities, expand)
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type pageCursor struct {
+	Sort  string `json:"sort"`
+	After []any  `json:"after"`
+}
+
+type pageResponse[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func parseLimit(c *gin.Context) (int, error) {
+	limit := c.Query("limit")
+	if limit == "" {
+		return defaultPageSize, nil
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("limit must be a positive integer")
+	}
+	if n > maxPageSize {
+		n = maxPageSize
+	}
+	return n, nil
+}
+
+func encodeCursor(sort string, after []any) string {
+	b, _ := json.Marshal(pageCursor{Sort: sort, After: after})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor returns the sort key values of the last row of the previous
+// page. The cursor is only valid with the sort order it was created with.
+func decodeCursor(cursor string, q *listQuery) ([]any, error) {
+	errInvalid := fmt.Errorf("cursor is invalid")
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalid
+	}
+
+	var pc struct {
+		Sort  string            `json:"sort"`
+		After []json.RawMessage `json:"after"`
+	}
+	if err := json.Unmarshal(b, &pc); err != nil {
+		return nil, errInvalid
+	}
+	if pc.Sort != q.sortParam() || len(pc.After) != len(q.order) {
+		return nil, fmt.Errorf("cursor does not match the sort order")
+	}
+
+	after := make([]any, len(pc.After))
+	for i, raw := range pc.After {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return nil, errInvalid
+		}
+		switch q.order[i].kind {
+		case intField:
+			number, ok := value.(json.Number)
+			if !ok {
+				return nil, errInvalid
+			}
+			n, err := number.Int64()
+			if err != nil {
+				return nil, errInvalid
+			}
+			after[i] = n
+		case floatField:
+			number, ok := value.(json.Number)
+			if !ok {
+				return nil, errInvalid
+			}
+			n, err := number.Float64()
+			if err != nil {
+				return nil, errInvalid
+			}
+			after[i] = n
+		default:
+			text, ok := value.(string)
+			if !ok {
+				return nil, errInvalid
+			}
+			after[i] = text
+		}
+	}
+	return after, nil
+}
+
+// addKeyset restricts q to the rows after the given sort key values.
+func addKeyset(q *listQuery, after []any) {
+	var alternatives []string
+	for i, key := range q.order {
+		var conditions []string
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, q.order[j].sortExpr()+" = "+q.arg(after[j]))
+		}
+		op := " > "
+		if key.desc {
+			op = " < "
+		}
+		conditions = append(conditions, key.sortExpr()+op+q.arg(after[i]))
+		alternatives = append(alternatives, "("+strings.Join(conditions, " AND ")+")")
+	}
+	q.where = append(q.where, "("+strings.Join(alternatives, " OR ")+")")
+}
+
+// listPage runs q with the request's filters, sort order and keyset
+// pagination. The scan function must scan the columns of q followed by keys,
+// which receive the sort key values. On failure the error response has
+// already been written and false is returned.
+func listPage[T any](
+	c *gin.Context,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+	allowed fields,
+	q listQuery,
+	scan func(rows pgx.Rows, keys []any) (T, error),
+) (pageResponse[T], bool) {
+	response := pageResponse[T]{Data: make([]T, 0)}
+
+	if err := parseListQuery(c, allowed, &q); err != nil {
+		writeProblem(c, http.StatusBadRequest, err.Error())
+		return response, false
+	}
+
+	limit, err := parseLimit(c)
+	if err != nil {
+		writeProblem(c, http.StatusBadRequest, err.Error())
+		return response, false
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor, &q)
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, err.Error())
+			return response, false
+		}
+		addKeyset(&q, after)
+	}
+
+	// One extra row tells whether there is a next page.
+	rows, err := queryFunc(c.Request.Context(), q.sql(limit+1), q.args...)
+	if err != nil {
+		writeDBError(c, err, "Resource")
+		return response, false
+	}
+	defer rows.Close()
+
+	values := make([]any, len(q.order))
+	keys := make([]any, len(q.order))
+	for i := range values {
+		keys[i] = &values[i]
+	}
+	var last []any
+	hasMore := false
+
+	for rows.Next() {
+		if len(response.Data) == limit {
+			hasMore = true
+			break
+		}
+		item, err := scan(rows, keys)
+		if err != nil {
+			writeDBError(c, err, "Resource")
+			return response, false
+		}
+		response.Data = append(response.Data, item)
+		last = append(last[:0], values...)
+	}
+	if err := rows.Err(); err != nil {
+		writeDBError(c, err, "Resource")
+		return response, false
+	}
+
+	if hasMore {
+		response.NextCursor = encodeCursor(q.sortParam(), last)
+	}
+
+	return response, true
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	traceIDKey         = "trace_id"
+)
+
+// Problem is an RFC 9457 problem details response.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	TraceID  string       `json:"trace_id,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func init() {
+	// Report validation errors with the JSON names of the fields.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// traceID returns the request-scoped trace id, creating it on first use.
+// It is the id of the OpenTelemetry trace when the request is traced.
+func traceID(c *gin.Context) string {
+	if id := c.GetString(traceIDKey); id != "" {
+		return id
+	}
+	if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.HasTraceID() {
+		id := spanContext.TraceID().String()
+		c.Set(traceIDKey, id)
+		return id
+	}
+	id := randomID()
+	c.Set(traceIDKey, id)
+	return id
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func newProblem(c *gin.Context, status int, detail string) Problem {
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request.URL.RequestURI(),
+		TraceID:  traceID(c),
+	}
+}
+
+func writeProblemResponse(c *gin.Context, problem Problem) {
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+func writeProblem(c *gin.Context, status int, detail string) {
+	writeProblemResponse(c, newProblem(c, status, detail))
+}
+
+// noRoute and noMethod replace the plain text responses of gin, so the
+// unknown paths and methods are problems too.
+func noRoute() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writeProblem(c, http.StatusNotFound, "No resource matches "+c.Request.URL.Path)
+	}
+}
+
+func noMethod() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writeProblem(c, http.StatusMethodNotAllowed, "Method "+c.Request.Method+" is not allowed on "+c.Request.URL.Path)
+	}
+}
+
+// writeInternalError logs err and writes a 500 response which does not
+// expose it to the client.
+func writeInternalError(c *gin.Context, err error) {
+	problem := newProblem(c, http.StatusInternalServerError, "An internal error occurred")
+	requestLogger(c).Error("Internal error", "error", err)
+	writeProblemResponse(c, problem)
+}
+
+// writeBindError writes a 400 response for a request body which could not
+// be decoded or validated, listing every failing field.
+func writeBindError(c *gin.Context, err error) {
+	problem := newProblem(c, http.StatusBadRequest, "Request body is invalid")
+
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &validationErrs):
+		for _, fe := range validationErrs {
+			problem.Errors = append(problem.Errors, FieldError{Field: fe.Field(), Message: validationMessage(fe)})
+		}
+	case errors.As(err, &typeErr):
+		problem.Errors = append(problem.Errors, FieldError{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()})
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		problem.Detail = "Request body is not valid JSON"
+	default:
+		problem.Detail = err.Error()
+	}
+
+	writeProblemResponse(c, problem)
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		return "must be at least " + fe.Param()
+	case "max", "lte":
+		return "must be at most " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "len":
+		return "must have length " + fe.Param()
+	case "required_with":
+		return "is required with " + strings.ToLower(fe.Param())
+	case "timezone":
+		return "must be an IANA time zone such as Europe/Helsinki"
+	case "numeric":
+		return "must be numeric"
+	case "iso3166_1_alpha2":
+		return "must be an ISO 3166-1 alpha-2 code"
+	case "iso3166_1_alpha3":
+		return "must be an ISO 3166-1 alpha-3 code"
+	case "iso3166_1_alpha_numeric":
+		return "must be an ISO 3166-1 numeric code"
+	case "calling_code":
+		return "must be a calling code such as +358"
+	case "tld":
+		return "must be a top-level domain such as .fi"
+	default:
+		return "is invalid (" + fe.Tag() + ")"
+	}
+}
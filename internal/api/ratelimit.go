@@ -0,0 +1,102 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/api/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitResultKey holds the bucket which the headers report, so that
+// the tighter of the address and the principal bucket is reported.
+const rateLimitResultKey = "rate_limit_result"
+
+// limitAddress runs before the authentication. Without the authentication,
+// every request takes the cost of its route from the bucket of its address.
+// With it, only the requests which fail the authentication take from the
+// address, so the API keys behind one NAT keep their own budgets. The
+// others are only checked against it, so a flood of invalid credentials is
+// rejected before they are looked up in the database.
+func limitAddress(store ratelimit.Store, limit ratelimit.Limit, routeCosts map[string]int, authenticated bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, cost := "ip:"+c.ClientIP(), routeCost(c, routeCosts)
+		if !authenticated {
+			if takeTokens(c, store, key, cost, limit) {
+				c.Next()
+			}
+			return
+		}
+
+		result, err := store.Peek(c.Request.Context(), key, cost, limit)
+		if err != nil {
+			// The API stays available when a shared store is not.
+			requestLogger(c).Warn("Rate limit store failed", "error", err)
+		} else if !checkResult(c, limit, result) {
+			return
+		}
+
+		c.Next()
+		if principal(c) == nil {
+			if _, err := store.Take(c.Request.Context(), key, cost, limit); err != nil {
+				requestLogger(c).Warn("Rate limit store failed", "error", err)
+			}
+		}
+	}
+}
+
+// limitPrincipal runs after the authentication, and takes the cost of the
+// route from the bucket of the API key or the token subject.
+func limitPrincipal(store ratelimit.Store, limit ratelimit.Limit, routeCosts map[string]int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := principal(c)
+		if p == nil {
+			c.Next()
+			return
+		}
+		if takeTokens(c, store, p.Method+":"+p.Subject, routeCost(c, routeCosts), limit) {
+			c.Next()
+		}
+	}
+}
+
+func routeCost(c *gin.Context, routeCosts map[string]int) int {
+	if cost, ok := routeCosts[c.FullPath()]; ok {
+		return cost
+	}
+	return 1
+}
+
+// takeTokens takes the cost from the bucket, or rejects the request with
+// 429 and returns false when the bucket is empty.
+func takeTokens(c *gin.Context, store ratelimit.Store, key string, cost int, limit ratelimit.Limit) bool {
+	result, err := store.Take(c.Request.Context(), key, cost, limit)
+	if err != nil {
+		requestLogger(c).Warn("Rate limit store failed", "error", err)
+		return true
+	}
+	return checkResult(c, limit, result)
+}
+
+func checkResult(c *gin.Context, limit ratelimit.Limit, result ratelimit.Result) bool {
+	if reported, ok := c.Get(rateLimitResultKey); !ok || result.Remaining < reported.(ratelimit.Result).Remaining {
+		c.Set(rateLimitResultKey, result)
+		c.Header("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	}
+	if !result.Allowed {
+		retryAfter := ceilSeconds(result.RetryAfter)
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		writeProblem(c, http.StatusTooManyRequests, fmt.Sprintf("Rate limit exceeded, retry in %d seconds", retryAfter))
+		return false
+	}
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -2,316 +2,615 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"example.com/api/internal/metrics"
+	"example.com/api/internal/ratelimit"
 	"example.com/api/internal/setup"
+	"example.com/api/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// newEngine returns an engine which takes the client address from the
+// X-Forwarded-For header only when the request comes from a trusted proxy.
+// Otherwise any client could pick its own address, and its rate limit.
+func newEngine(trustedProxies []string) *gin.Engine {
+	engine := gin.New()
+	// The configuration has validated the proxies.
+	_ = engine.SetTrustedProxies(trustedProxies)
+	return engine
+}
+
 func InitializeRoutes() {
 	cfg := setup.GetConfig()
-	cfg.GinEngine = gin.New()
-
-	cfg.GinEngine.POST("api/v1/continent", createContinent(cfg.PgPool.QueryRow))
-	cfg.GinEngine.GET("api/v1/continent/:id", getContinent(cfg.PgPool.QueryRow))
-	cfg.GinEngine.GET("api/v1/continents", getAllContinents(cfg.PgPool.Query))
-	cfg.GinEngine.PUT("api/v1/continent/:id", updateContinent(cfg.PgPool.Exec))
-	cfg.GinEngine.DELETE("api/v1/continent/:id", deleteContinent(cfg.PgPool.Exec))
-
-	cfg.GinEngine.POST("api/v1/country", createCountry(cfg.PgPool.QueryRow))
-	cfg.GinEngine.GET("api/v1/country/:id", getCountry(cfg.PgPool.QueryRow))
-	cfg.GinEngine.GET("api/v1/countries", getAllCountries(cfg.PgPool.Query))
-	cfg.GinEngine.PUT("api/v1/country/:id", updateCountry(cfg.PgPool.Exec))
-	cfg.GinEngine.DELETE("api/v1/country/:id", deleteCountry(cfg.PgPool.Exec))
-
-	cfg.GinEngine.POST("api/v1/city", createCity(cfg.PgPool.QueryRow))
-	cfg.GinEngine.GET("api/v1/city/:id", getCity(cfg.PgPool.QueryRow))
-	cfg.GinEngine.GET("api/v1/cities", getAllCities(cfg.PgPool.Query))
-	cfg.GinEngine.PUT("api/v1/city/:id", updateCity(cfg.PgPool.Exec))
-	cfg.GinEngine.DELETE("api/v1/city/:id", deleteCity(cfg.PgPool.Exec))
+	cfg.GinEngine = newEngine(cfg.TrustedProxies.List())
+	cfg.GinEngine.HandleMethodNotAllowed = true
+	cfg.GinEngine.NoRoute(noRoute())
+	cfg.GinEngine.NoMethod(noMethod())
+	cfg.GinEngine.Use(tracing.Middleware(), metrics.Middleware(), requestID(), accessLog(), recovery())
+
+	if origins := cfg.CorsAllowedOrigins.List(); len(origins) > 0 {
+		cfg.GinEngine.Use(cors(origins))
+	}
+
+	healthChecks := cfg.HealthChecks()
+	cfg.GinEngine.GET("healthz", liveness())
+	cfg.GinEngine.GET("readyz", readiness(cfg.Health, healthChecks))
+
+	// The middleware applies to the routes which are registered after it,
+	// so the health endpoints answer while the server is starting.
+	cfg.GinEngine.Use(requireStarted(cfg.Health), statementTimeout(cfg.DbStatementTimeout.Duration(), cfg.RouteStatementTimeouts()))
+	limit, limitStore := cfg.RateLimit(), ratelimit.NewMemoryStore()
+	authenticators := newAuthenticators(cfg)
+	if limit.Burst > 0 {
+		cfg.GinEngine.Use(limitAddress(limitStore, limit, cfg.RouteCosts(), len(authenticators) > 0))
+	}
+	if len(authenticators) > 0 {
+		cfg.GinEngine.Use(authenticate(authenticators))
+		if limit.Burst > 0 {
+			cfg.GinEngine.Use(limitPrincipal(limitStore, limit, cfg.RouteCosts()))
+		}
+	}
+
+	roleScopes := cfg.RoleScopes()
+	read := authorize(roleScopes, policy{scopes: []string{scopeRead}})
+	write := authorize(roleScopes, policy{scopes: []string{scopeWrite}})
+	writeCountry := authorize(roleScopes, policy{scopes: []string{scopeWrite}, continents: countryContinents(cfg.PgPool.QueryRow)})
+	writeCity := authorize(roleScopes, policy{scopes: []string{scopeWrite}, continents: cityContinents(cfg.PgPool.QueryRow, false)})
+	writeCountryCity := authorize(roleScopes, policy{scopes: []string{scopeWrite}, continents: cityContinents(cfg.PgPool.QueryRow, true)})
+
+	cfg.GinEngine.POST("api/v1/continent", write, createContinent(cfg.PgPool.QueryRow))
+	cfg.GinEngine.GET("api/v1/continent/:id", read, getContinent(cfg.PgPool.QueryRow))
+	cfg.GinEngine.GET("api/v1/continents", read, getAllContinents(cfg.PgPool.Query))
+	cfg.GinEngine.GET("api/v1/continents/:id/countries", read, getContinentCountries(cfg.PgPool.QueryRow, cfg.PgPool.Query))
+	cfg.GinEngine.GET("api/v1/continents/:id/cities", read, getContinentCities(cfg.PgPool.QueryRow, cfg.PgPool.Query))
+	cfg.GinEngine.PUT("api/v1/continent/:id", write, updateContinent(cfg.PgPool.QueryRow))
+	cfg.GinEngine.DELETE("api/v1/continent/:id", write, deleteContinent(cfg.PgPool.Exec))
+
+	cfg.GinEngine.POST("api/v1/country", writeCountry, createCountry(cfg.PgPool.QueryRow))
+	cfg.GinEngine.GET("api/v1/country/:id", read, getCountry(cfg.PgPool.QueryRow, cfg.PgPool.Query))
+	cfg.GinEngine.GET("api/v1/countries/by-code/:code", read, getCountryByCode(cfg.PgPool.QueryRow, cfg.PgPool.Query))
+	cfg.GinEngine.GET("api/v1/countries", read, getAllCountries(cfg.PgPool.Query))
+	cfg.GinEngine.GET("api/v1/countries/:id/cities", read, getCountryCities(cfg.PgPool.QueryRow, cfg.PgPool.Query))
+	cfg.GinEngine.POST("api/v1/countries/:id/cities", writeCountryCity, createCountryCity(cfg.PgPool.QueryRow))
+	cfg.GinEngine.PUT("api/v1/country/:id", writeCountry, updateCountry(cfg.PgPool.QueryRow))
+	cfg.GinEngine.DELETE("api/v1/country/:id", writeCountry, deleteCountry(cfg.PgPool.Exec))
+	cfg.GinEngine.PUT("api/v1/country/:id/boundary", writeCountry, putCountryBoundary(cfg.PgPool.Exec))
+	cfg.GinEngine.DELETE("api/v1/country/:id/boundary", writeCountry, deleteCountryBoundary(cfg.PgPool.Exec))
+
+	cfg.GinEngine.POST("api/v1/city", writeCity, createCity(cfg.PgPool.QueryRow))
+	cfg.GinEngine.GET("api/v1/city/:id", read, getCity(cfg.PgPool.QueryRow, cfg.PgPool.Query))
+	cfg.GinEngine.GET("api/v1/cities", read, getAllCities(cfg.PgPool.Query))
+	cfg.GinEngine.GET("api/v1/cities/nearby", read, getNearbyCities(cfg.PgPool.Query))
+	cfg.GinEngine.GET("api/v1/cities/nearest", read, getNearestCity(cfg.PgPool.Query))
+	cfg.GinEngine.GET("api/v1/cities/distances", read, getDistanceMatrix(cfg.PgPool.Query, cfg.DistanceMatrixMax.Int()))
+	cfg.GinEngine.GET("api/v1/cities/:id/distance/:otherId", read, getCityDistance(cfg.PgPool.Query))
+	cfg.GinEngine.PUT("api/v1/city/:id", writeCity, updateCity(cfg.PgPool.QueryRow))
+	cfg.GinEngine.DELETE("api/v1/city/:id", writeCity, deleteCity(cfg.PgPool.Exec))
 }
 
 func createContinent(queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var input struct {
-			Name string `json:"name" binding:"required"`
-		}
-
-		if err := c.BindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var input ContinentInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			writeBindError(c, err)
 			return
 		}
 
-		var id string
-		err := queryRowFunc(context.Background(), "INSERT INTO continents (name) VALUES ($1) RETURNING id", input.Name).Scan(&id)
+		var continent Continent
+		err := queryRowFunc(c.Request.Context(), "INSERT INTO continents (name) VALUES ($1) RETURNING "+continentColumns, input.Name).Scan(continent.scanTargets()...)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeDBError(c, err, "Continent")
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{"id": id})
+		c.Header("Location", "/api/v1/continent/"+strconv.Itoa(continent.ID))
+		c.JSON(http.StatusCreated, continent)
 	}
 }
 
 func createCountry(queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var input struct {
-			Name        string `json:"name" binding:"required"`
-			ContinentID int    `json:"continent_id" binding:"required"`
-		}
-		if err := c.BindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var input CountryInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			writeBindError(c, err)
 			return
 		}
 
-		var id string
-		err := queryRowFunc(context.Background(), "INSERT INTO countries (name, continent_id) VALUES ($1, $2) RETURNING id", input.Name, input.ContinentID).Scan(&id)
+		var country Country
+		err := queryRowFunc(c.Request.Context(), "INSERT INTO countries ("+countryInputColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING "+countryColumns, input.args()...).Scan(country.scanTargets()...)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeDBError(c, err, "Country")
 			return
 		}
-		c.JSON(http.StatusCreated, gin.H{"id": id})
+
+		c.Header("Location", "/api/v1/country/"+strconv.Itoa(country.ID))
+		c.JSON(http.StatusCreated, country)
 	}
 }
 
 func createCity(queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var input struct {
-			Name      string `json:"name" binding:"required"`
-			CountryID int    `json:"country_id" binding:"required"`
+		var input CityInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			writeBindError(c, err)
+			return
 		}
-		if err := c.BindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		insertCity(c, queryRowFunc, input)
+	}
+}
+
+func createCountryCity(queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		countryID, ok := findParent(c, queryRowFunc, "countries", "Country")
+		if !ok {
 			return
 		}
 
-		var id string
-		err := queryRowFunc(context.Background(), "INSERT INTO cities (name, country_id) VALUES ($1, $2) RETURNING id", input.Name, input.CountryID).Scan(&id)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// The country comes from the path, so the body only needs the name.
+		input := CityInput{CountryID: countryID}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			writeBindError(c, err)
 			return
 		}
-		c.JSON(http.StatusCreated, gin.H{"id": id})
+		input.CountryID = countryID
+
+		insertCity(c, queryRowFunc, input)
 	}
 }
 
+func insertCity(c *gin.Context, queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row, input CityInput) {
+	var city City
+	err := queryRowFunc(c.Request.Context(), "INSERT INTO cities ("+cityInputColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING "+cityColumns, input.args()...).Scan(city.scanTargets()...)
+	if err != nil {
+		writeDBError(c, err, "City")
+		return
+	}
+
+	c.Header("Location", "/api/v1/city/"+strconv.Itoa(city.ID))
+	c.JSON(http.StatusCreated, city)
+}
+
 func getContinent(queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		var name string
-		err := queryRowFunc(context.Background(), "SELECT name FROM continents WHERE id=$1", id).Scan(&name)
+		var continent Continent
+		err := queryRowFunc(c.Request.Context(), "SELECT "+continentColumns+" FROM continents WHERE id=$1", id).Scan(continent.scanTargets()...)
 		if err != nil {
-			if err == pgx.ErrNoRows {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Continent not found"})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			}
+			writeDBError(c, err, "Continent")
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"name": name})
+		c.JSON(http.StatusOK, continent)
 	}
 }
 
-func getCountry(queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row) gin.HandlerFunc {
+func getCountry(
+	queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		var name string
-		var continentID int
-		err := queryRowFunc(context.Background(), "SELECT name, continent_id FROM countries WHERE id=$1", id).Scan(&name, &continentID)
+		expand, err := parseExpand(c, countryExpands)
 		if err != nil {
-			if err == pgx.ErrNoRows {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Country not found"})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			}
+			writeProblem(c, http.StatusBadRequest, err.Error())
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"name": name, "continent_id": continentID})
+
+		findCountry(c, queryRowFunc, queryFunc, "id", c.Param("id"), expand)
 	}
 }
 
-func getCity(queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row) gin.HandlerFunc {
+// getCountryByCode looks up a country by its ISO 3166-1 alpha-2, alpha-3 or
+// numeric code, in any case.
+func getCountryByCode(
+	queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		var name string
-		var countryID int
-		err := queryRowFunc(context.Background(), "SELECT name, country_id FROM cities WHERE id=$1", id).Scan(&name, &countryID)
+		expand, err := parseExpand(c, countryExpands)
 		if err != nil {
-			if err == pgx.ErrNoRows {
-				c.JSON(http.StatusNotFound, gin.H{"error": "City not found"})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			}
+			writeProblem(c, http.StatusBadRequest, err.Error())
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"name": name, "country_id": countryID})
+
+		column, code, err := parseCountryCode(c.Param("code"))
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		findCountry(c, queryRowFunc, queryFunc, column, code, expand)
 	}
 }
 
-func getAllContinents(queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error)) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		rows, err := queryFunc(context.Background(), "SELECT id, name FROM continents")
+func parseCountryCode(code string) (string, string, error) {
+	code = strings.ToUpper(code)
+	switch {
+	case isoNumericPattern.MatchString(code):
+		return "iso_numeric", code, nil
+	case isoAlpha2Pattern.MatchString(code):
+		return "iso_alpha2", code, nil
+	case isoAlpha3Pattern.MatchString(code):
+		return "iso_alpha3", code, nil
+	default:
+		return "", "", fmt.Errorf("code must be an ISO 3166-1 alpha-2, alpha-3 or numeric code")
+	}
+}
+
+// findCountry writes the country, or in GeoJSON a feature with its
+// boundary simplified by the tolerance parameter.
+func findCountry(
+	c *gin.Context,
+	queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+	column string,
+	value string,
+	expand map[string]bool,
+) {
+	format, err := responseFormat(c, true)
+	if err != nil {
+		writeProblem(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	tolerance, err := parseTolerance(c)
+	if err != nil {
+		writeProblem(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The boundary can be large, so it is only read for GeoJSON.
+	var country Country
+	var boundary []byte
+	columns, targets := countryColumns, country.scanTargets()
+	if format == formatGeoJSON {
+		columns, targets = countryColumns+", boundary", append(targets, &boundary)
+	}
+	err = queryRowFunc(c.Request.Context(), "SELECT "+columns+" FROM countries WHERE "+column+"=$1", value).Scan(targets...)
+	if err != nil {
+		writeDBError(c, err, "Country")
+		return
+	}
+
+	if err := expandCountries(c.Request.Context(), queryFunc, []*Country{&country}, expand); err != nil {
+		writeDBError(c, err, "Country")
+		return
+	}
+	if format != formatGeoJSON {
+		c.JSON(http.StatusOK, country)
+		return
+	}
+
+	feature := Feature{Type: "Feature", ID: country.ID, Properties: country}
+	if boundary != nil {
+		geometry, err := parseBoundary(boundary)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeInternalError(c, fmt.Errorf("country %d boundary: %w", country.ID, err))
 			return
 		}
-		defer rows.Close()
+		feature.Geometry = geometry.simplify(tolerance)
+	}
+	writeGeoJSON(c, http.StatusOK, feature)
+}
 
-		var continents = make([]struct {
-			ID   int    `json:"id" binding:"required"`
-			Name string `json:"name" binding:"required"`
-		}, 0)
+// putCountryBoundary replaces the boundary of the country with a GeoJSON
+// Polygon or MultiPolygon geometry.
+func putCountryBoundary(execFunc func(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		boundary, ok := readBoundary(c)
+		if !ok {
+			return
+		}
 
-		for rows.Next() {
-			var continent struct {
-				ID   int    `json:"id" binding:"required"`
-				Name string `json:"name" binding:"required"`
-			}
-			if err := rows.Scan(&continent.ID, &continent.Name); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-			continents = append(continents, continent)
+		data, _ := json.Marshal(boundary)
+		tag, err := execFunc(c.Request.Context(), "UPDATE countries SET boundary=$1, updated_at=now() WHERE id=$2", string(data), c.Param("id"))
+		if err != nil {
+			writeDBError(c, err, "Country")
+			return
 		}
+		if tag.RowsAffected() == 0 {
+			writeProblem(c, http.StatusNotFound, "Country not found")
+			return
+		}
+		writeGeoJSON(c, http.StatusOK, boundary)
+	}
+}
 
-		c.JSON(http.StatusOK, continents)
+func deleteCountryBoundary(execFunc func(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tag, err := execFunc(c.Request.Context(), "UPDATE countries SET boundary=NULL, updated_at=now() WHERE id=$1", c.Param("id"))
+		if err != nil {
+			writeDBError(c, err, "Country")
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			writeProblem(c, http.StatusNotFound, "Country not found")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 	}
 }
 
-func getAllCountries(queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error)) gin.HandlerFunc {
+func getCity(
+	queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		rows, err := queryFunc(context.Background(), "SELECT id, name, continent_id FROM countries")
+		expand, err := parseExpand(c, cityExpands)
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		format, err := responseFormat(c, true)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeProblem(c, http.StatusBadRequest, err.Error())
 			return
 		}
-		defer rows.Close()
 
-		var countries = make([]struct {
-			ID          int    `json:"id" binding:"required"`
-			Name        string `json:"name" binding:"required"`
-			ContinentID int    `json:"continent_id" binding:"required"`
-		}, 0)
+		id := c.Param("id")
+		var city City
+		err = queryRowFunc(c.Request.Context(), "SELECT "+cityColumns+" FROM cities WHERE id=$1", id).Scan(city.scanTargets()...)
+		if err != nil {
+			writeDBError(c, err, "City")
+			return
+		}
 
-		for rows.Next() {
-			var country struct {
-				ID          int    `json:"id" binding:"required"`
-				Name        string `json:"name" binding:"required"`
-				ContinentID int    `json:"continent_id" binding:"required"`
-			}
-			if err := rows.Scan(&country.ID, &country.Name, &country.ContinentID); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-			countries = append(countries, country)
+		if err := expandCities(c.Request.Context(), queryFunc, []*City{&city}, expand); err != nil {
+			writeDBError(c, err, "City")
+			return
 		}
+		if format == formatGeoJSON {
+			writeGeoJSON(c, http.StatusOK, cityFeature(city, city))
+			return
+		}
+		c.JSON(http.StatusOK, city)
+	}
+}
+
+func getAllContinents(queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listContinents(c, queryFunc, listQuery{columns: continentColumns, from: "continents"})
+	}
+}
 
-		c.JSON(http.StatusOK, countries)
+func getAllCountries(queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listCountries(c, queryFunc, listQuery{columns: countryColumns, from: "countries"})
 	}
 }
 
 func getAllCities(queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		rows, err := queryFunc(context.Background(), "SELECT id, name, country_id FROM cities")
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		listCities(c, queryFunc, listQuery{columns: cityColumns, from: "cities"})
+	}
+}
+
+func getContinentCountries(
+	queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		continentID, ok := findParent(c, queryRowFunc, "continents", "Continent")
+		if !ok {
 			return
 		}
-		defer rows.Close()
 
-		var cities = make([]struct {
-			ID        int    `json:"id" binding:"required"`
-			Name      string `json:"name" binding:"required"`
-			CountryID int    `json:"country_id" binding:"required"`
-		}, 0)
+		q := listQuery{columns: countryColumns, from: "countries"}
+		q.where = append(q.where, "continent_id = "+q.arg(continentID))
+		listCountries(c, queryFunc, q)
+	}
+}
 
-		for rows.Next() {
-			var city struct {
-				ID        int    `json:"id" binding:"required"`
-				Name      string `json:"name" binding:"required"`
-				CountryID int    `json:"country_id" binding:"required"`
-			}
-			if err := rows.Scan(&city.ID, &city.Name, &city.CountryID); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-			cities = append(cities, city)
+func getContinentCities(
+	queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		continentID, ok := findParent(c, queryRowFunc, "continents", "Continent")
+		if !ok {
+			return
 		}
 
-		c.JSON(http.StatusOK, cities)
+		q := listQuery{columns: cityColumns, from: "cities"}
+		q.where = append(q.where, "country_id IN (SELECT id FROM countries WHERE continent_id = "+q.arg(continentID)+")")
+		listCities(c, queryFunc, q)
 	}
 }
 
-func updateContinent(execFunc func(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)) gin.HandlerFunc {
+func getCountryCities(
+	queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row,
+	queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error),
+) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		var input struct {
-			Name string `json:"name"`
+		countryID, ok := findParent(c, queryRowFunc, "countries", "Country")
+		if !ok {
+			return
 		}
-		if err := c.BindJSON(&input); err != nil {
-			c.JSON(400, gin.H{"error": err.Error()})
+
+		q := listQuery{columns: cityColumns, from: "cities"}
+		q.where = append(q.where, "country_id = "+q.arg(countryID))
+		listCities(c, queryFunc, q)
+	}
+}
+
+func listContinents(c *gin.Context, queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error), q listQuery) {
+	if _, err := responseFormat(c, false); err != nil {
+		writeProblem(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response, ok := listPage(c, queryFunc, continentFields, q, func(rows pgx.Rows, keys []any) (Continent, error) {
+		var item Continent
+		err := rows.Scan(append(item.scanTargets(), keys...)...)
+		return item, err
+	})
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func listCountries(c *gin.Context, queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error), q listQuery) {
+	expand, err := parseExpand(c, countryExpands)
+	if err != nil {
+		writeProblem(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := responseFormat(c, false); err != nil {
+		writeProblem(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response, ok := listPage(c, queryFunc, countryFields, q, func(rows pgx.Rows, keys []any) (Country, error) {
+		var item Country
+		err := rows.Scan(append(item.scanTargets(), keys...)...)
+		return item, err
+	})
+	if !ok {
+		return
+	}
+
+	countries := make([]*Country, len(response.Data))
+	for i := range response.Data {
+		countries[i] = &response.Data[i]
+	}
+	if err := expandCountries(c.Request.Context(), queryFunc, countries, expand); err != nil {
+		writeDBError(c, err, "Country")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func listCities(c *gin.Context, queryFunc func(ctx context.Context, sql string, args ...any) (pgx.Rows, error), q listQuery) {
+	expand, err := parseExpand(c, cityExpands)
+	if err != nil {
+		writeProblem(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	format, err := responseFormat(c, true)
+	if err != nil {
+		writeProblem(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response, ok := listPage(c, queryFunc, cityFields, q, func(rows pgx.Rows, keys []any) (City, error) {
+		var item City
+		err := rows.Scan(append(item.scanTargets(), keys...)...)
+		return item, err
+	})
+	if !ok {
+		return
+	}
+
+	cities := make([]*City, len(response.Data))
+	for i := range response.Data {
+		cities[i] = &response.Data[i]
+	}
+	if err := expandCities(c.Request.Context(), queryFunc, cities, expand); err != nil {
+		writeDBError(c, err, "City")
+		return
+	}
+	if format == formatGeoJSON {
+		writeGeoJSON(c, http.StatusOK, FeatureCollection{Type: "FeatureCollection", Features: cityFeatures(response.Data), NextCursor: response.NextCursor})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// findParent returns the parent id of a nested route, or writes an error
+// response if the id is invalid or the parent does not exist.
+func findParent(c *gin.Context, queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row, table string, resource string) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		writeProblem(c, http.StatusBadRequest, "id must be an integer")
+		return 0, false
+	}
+
+	var exists bool
+	err = queryRowFunc(c.Request.Context(), "SELECT EXISTS (SELECT 1 FROM "+table+" WHERE id=$1)", id).Scan(&exists)
+	if err != nil {
+		writeDBError(c, err, resource)
+		return 0, false
+	}
+	if !exists {
+		writeProblem(c, http.StatusNotFound, resource+" not found")
+		return 0, false
+	}
+
+	return id, true
+}
+
+func updateContinent(queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var input ContinentInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			writeBindError(c, err)
 			return
 		}
 
-		_, err := execFunc(context.Background(), "UPDATE continents SET name=$1 WHERE id=$2", input.Name, id)
+		var continent Continent
+		err := queryRowFunc(c.Request.Context(), "UPDATE continents SET name=$1, updated_at=now() WHERE id=$2 RETURNING "+continentColumns, input.Name, id).Scan(continent.scanTargets()...)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeDBError(c, err, "Continent")
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"status": "updated"})
+		c.JSON(http.StatusOK, continent)
 	}
 }
 
-func updateCountry(execFunc func(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)) gin.HandlerFunc {
+func updateCountry(queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		var input struct {
-			Name        string `json:"name" binding:"required"`
-			ContinentID int    `json:"continent_id" binding:"required"`
-		}
-		if err := c.BindJSON(&input); err != nil {
-			c.JSON(400, gin.H{"error": err.Error()})
+		var input CountryInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			writeBindError(c, err)
 			return
 		}
 
-		_, err := execFunc(context.Background(), "UPDATE countries SET name=$1, continent_id=$2 WHERE id=$3", input.Name, input.ContinentID, id)
+		var country Country
+		err := queryRowFunc(c.Request.Context(), "UPDATE countries SET ("+countryInputColumns+", updated_at) = ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, now()) WHERE id=$12 RETURNING "+countryColumns, append(input.args(), id)...).Scan(country.scanTargets()...)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeDBError(c, err, "Country")
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"status": "updated"})
+		c.JSON(http.StatusOK, country)
 	}
 }
 
-func updateCity(execFunc func(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)) gin.HandlerFunc {
+func updateCity(queryRowFunc func(ctx context.Context, sql string, args ...any) pgx.Row) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		var input struct {
-			Name      string `json:"name" binding:"required"`
-			CountryID int    `json:"country_id" binding:"required"`
-		}
-		if err := c.BindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var input CityInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			writeBindError(c, err)
 			return
 		}
 
-		_, err := execFunc(context.Background(), "UPDATE cities SET name=$1, country_id=$2 WHERE id=$3", input.Name, input.CountryID, id)
+		var city City
+		err := queryRowFunc(c.Request.Context(), "UPDATE cities SET ("+cityInputColumns+", updated_at) = ($1, $2, $3, $4, $5, $6, $7, now()) WHERE id=$8 RETURNING "+cityColumns, append(input.args(), id)...).Scan(city.scanTargets()...)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeDBError(c, err, "City")
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"status": "updated"})
+		c.JSON(http.StatusOK, city)
 	}
 }
 
 func deleteContinent(execFunc func(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		_, err := execFunc(context.Background(), "DELETE FROM continents WHERE id=$1", id)
+		tag, err := execFunc(c.Request.Context(), "DELETE FROM continents WHERE id=$1", id)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeDBError(c, err, "Continent")
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			writeProblem(c, http.StatusNotFound, "Continent not found")
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
@@ -321,9 +620,13 @@ func deleteContinent(execFunc func(ctx context.Context, sql string, arguments ..
 func deleteCountry(execFunc func(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		_, err := execFunc(context.Background(), "DELETE FROM countries WHERE id=$1", id)
+		tag, err := execFunc(c.Request.Context(), "DELETE FROM countries WHERE id=$1", id)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeDBError(c, err, "Country")
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			writeProblem(c, http.StatusNotFound, "Country not found")
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
@@ -333,9 +636,13 @@ func deleteCountry(execFunc func(ctx context.Context, sql string, arguments ...a
 func deleteCity(execFunc func(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		_, err := execFunc(context.Background(), "DELETE FROM cities WHERE id=$1", id)
+		tag, err := execFunc(c.Request.Context(), "DELETE FROM cities WHERE id=$1", id)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeDBError(c, err, "City")
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			writeProblem(c, http.StatusNotFound, "City not found")
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{"status": "deleted"})
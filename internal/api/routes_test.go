@@ -1,13 +1,23 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os/exec"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"example.com/api/internal/auth"
+	"example.com/api/internal/ratelimit"
 	"example.com/api/internal/setup"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
@@ -29,7 +39,7 @@ func mockQuery(_ context.Context, _ string, _ ...any) (pgx.Rows, error) {
 
 // ctx context.Context, sql string, args ...any
 func mockExec(_ context.Context, _ string, _ ...any) (pgconn.CommandTag, error) {
-	return pgconn.CommandTag{}, nil
+	return pgconn.NewCommandTag("DELETE 1"), nil
 }
 
 // ctx context.Context, sql string, args ...any
@@ -37,12 +47,26 @@ func mockQueryRow(_ context.Context, _ string, _ ...any) pgx.Row {
 	return &mockRow{}
 }
 
-type mockRow struct{}
+// ctx context.Context, sql string, args ...any
+func mockQueryRowMissing(_ context.Context, _ string, _ ...any) pgx.Row {
+	return &mockRow{missing: true}
+}
+
+type mockRow struct {
+	missing bool
+}
 
 func (m *mockRow) Scan(dest ...interface{}) error {
-	if len(dest) >= 1 {
-		if name, ok := dest[0].(*string); ok {
-			*name = "Europe"
+	for _, d := range dest {
+		switch d := d.(type) {
+		case *int:
+			*d = 1
+		case *string:
+			*d = "Europe"
+		case *bool:
+			*d = !m.missing
+		case *time.Time:
+			*d = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
 		}
 	}
 	return nil
@@ -92,6 +116,11 @@ func (m *mockRows) Scan(dest ...interface{}) error {
 				*name = continent.Name
 			}
 		}
+		for _, d := range dest[2:] {
+			if key, ok := d.(*any); ok {
+				*key = continent.ID
+			}
+		}
 		return nil
 	}
 	return nil
@@ -109,8 +138,80 @@ func (m *mockRows) Conn() *pgx.Conn {
 	return nil
 }
 
+type mockErrorRow struct {
+	err error
+}
+
+func (m *mockErrorRow) Scan(_ ...interface{}) error {
+	return m.err
+}
+
+type mockValueRow struct {
+	values []any
+}
+
+func (m *mockValueRow) Scan(dest ...interface{}) error {
+	for i, d := range dest {
+		if i >= len(m.values) {
+			break
+		}
+		switch d := d.(type) {
+		case *int:
+			*d = m.values[i].(int)
+		case *string:
+			*d = m.values[i].(string)
+		case *float64:
+			*d = m.values[i].(float64)
+		case **float64:
+			if v, ok := m.values[i].(float64); ok {
+				*d = &v
+			}
+		case **string:
+			if v, ok := m.values[i].(string); ok {
+				*d = &v
+			}
+		case *[]byte:
+			if v, ok := m.values[i].([]byte); ok {
+				*d = v
+			}
+		case *any:
+			*d = m.values[i]
+		case *time.Time:
+			if t, ok := m.values[i].(time.Time); ok {
+				*d = t
+			}
+		}
+	}
+	return nil
+}
+
+type mockValueRows struct {
+	mockRows
+	rows [][]any
+}
+
+func (m *mockValueRows) Next() bool {
+	m.index++
+	return m.index <= len(m.rows)
+}
+
+func (m *mockValueRows) Scan(dest ...interface{}) error {
+	return (&mockValueRow{values: m.rows[m.index-1]}).Scan(dest...)
+}
+
 type mockPgxPool struct{}
 
+type recordingQuery struct {
+	sql  string
+	args []any
+}
+
+func (r *recordingQuery) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	r.sql = sql
+	r.args = args
+	return mockQuery(ctx, sql, args...)
+}
+
 func (m *mockPgxPool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
 	return mockExec(ctx, sql, args...)
 }
@@ -151,10 +252,17 @@ func TestCreateContinent(t *testing.T) {
 		t.Errorf("Expected status code %d, but got %d", http.StatusCreated, w.Code)
 	}
 
-	var response map[string]string
+	var response Continent
 	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
 		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
+
+	if response.ID != 1 || response.Name != "Europe" {
+		t.Errorf("Expected continent 1 'Europe', but got %d '%s'", response.ID, response.Name)
+	}
+	if w.Header().Get("Location") != "/api/v1/continent/1" {
+		t.Errorf("Expected Location '/api/v1/continent/1', but got '%s'", w.Header().Get("Location"))
+	}
 }
 
 func TestGetContinent(t *testing.T) {
@@ -179,13 +287,19 @@ func TestGetContinent(t *testing.T) {
 		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
 	}
 
-	var response map[string]string
+	var response Continent
 	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
 		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
 
-	if response["name"] != "Europe" {
-		t.Errorf("Expected name 'Europe', but got '%s'", response["name"])
+	if response.ID != 1 {
+		t.Errorf("Expected id 1, but got %d", response.ID)
+	}
+	if response.Name != "Europe" {
+		t.Errorf("Expected name 'Europe', but got '%s'", response.Name)
+	}
+	if response.CreatedAt.IsZero() {
+		t.Errorf("Expected created_at to be set")
 	}
 }
 
@@ -211,19 +325,80 @@ func TestGetAllContinents(t *testing.T) {
 		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
 	}
 
-	var response []map[string]interface{}
+	var response struct {
+		Data       []map[string]interface{} `json:"data"`
+		NextCursor string                   `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if len(response.Data) != 2 {
+		t.Errorf("Expected 2 continents, but got %d", len(response.Data))
+	}
+	if response.Data[0]["name"] != "Europe" {
+		t.Errorf("Expected name 'Europe', but got '%s'", response.Data[0]["name"])
+	}
+	if response.Data[1]["name"] != "Asia" {
+		t.Errorf("Expected name 'Asia', but got '%s'", response.Data[1]["name"])
+	}
+	if response.NextCursor != "" {
+		t.Errorf("Expected no next cursor, but got '%s'", response.NextCursor)
+	}
+}
+
+func TestGetAllContinentsPaginated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	mockDBPool := &mockPgxPool{}
+
+	router.GET("/api/v1/continents", getAllContinents(mockDBPool.Query))
+
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/continents?limit=1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+
+	var response struct {
+		Data       []map[string]interface{} `json:"data"`
+		NextCursor string                   `json:"next_cursor"`
+	}
 	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
 		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
 
-	if len(response) != 2 {
-		t.Errorf("Expected 2 continents, but got %d", len(response))
+	if len(response.Data) != 1 {
+		t.Errorf("Expected 1 continent, but got %d", len(response.Data))
 	}
-	if response[0]["name"] != "Europe" {
-		t.Errorf("Expected name 'Europe', but got '%s'", response[0]["name"])
+	if response.NextCursor != encodeCursor("id", []any{1}) {
+		t.Errorf("Expected next cursor '%s', but got '%s'", encodeCursor("id", []any{1}), response.NextCursor)
+	}
+}
+
+func TestGetAllContinentsInvalidCursor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	mockDBPool := &mockPgxPool{}
+
+	router.GET("/api/v1/continents", getAllContinents(mockDBPool.Query))
+
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/continents?cursor=not-a-cursor", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
 	}
-	if response[1]["name"] != "Asia" {
-		t.Errorf("Expected name 'Asia', but got '%s'", response[1]["name"])
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
 	}
 }
 
@@ -235,7 +410,7 @@ func TestUpdateContinent(t *testing.T) {
 	cfg.GinEngine = router
 	cfg.PgPool = mockDBPool
 
-	router.PUT("/api/v1/continent/:id", updateContinent(mockDBPool.Exec))
+	router.PUT("/api/v1/continent/:id", updateContinent(mockDBPool.QueryRow))
 
 	body := `{"name":"Updated Europe"}`
 	req, err := http.NewRequest(http.MethodPut, "/api/v1/continent/1", strings.NewReader(body))
@@ -251,13 +426,13 @@ func TestUpdateContinent(t *testing.T) {
 		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
 	}
 
-	var response map[string]string
+	var response Continent
 	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
 		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
 
-	if response["status"] != "updated" {
-		t.Errorf("Expected status 'updated', but got '%s'", response["status"])
+	if response.ID != 1 {
+		t.Errorf("Expected id 1, but got %d", response.ID)
 	}
 }
 
@@ -292,3 +467,1444 @@ func TestDeleteContinent(t *testing.T) {
 		t.Errorf("Expected status 'deleted', but got '%s'", response["status"])
 	}
 }
+
+func TestGetAllCountriesFiltered(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	recorder := &recordingQuery{}
+
+	router.GET("/api/v1/countries", getAllCountries(recorder.Query))
+
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/countries?continent_id=3&name__ilike=par%25&id__in=1,2&sort=-name", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+
+	expectedSQL := "SELECT " + countryColumns + ", name, id FROM countries" +
+		" WHERE continent_id = $1 AND id IN ($2, $3) AND name ILIKE $4 ORDER BY name DESC, id LIMIT $5"
+	if recorder.sql != expectedSQL {
+		t.Errorf("Expected SQL '%s', but got '%s'", expectedSQL, recorder.sql)
+	}
+
+	expectedArgs := []any{int64(3), int64(1), int64(2), "par%", defaultPageSize + 1}
+	if len(recorder.args) != len(expectedArgs) {
+		t.Fatalf("Expected %d args, but got %d", len(expectedArgs), len(recorder.args))
+	}
+	for i := range expectedArgs {
+		if recorder.args[i] != expectedArgs[i] {
+			t.Errorf("Expected arg %d to be '%v', but got '%v'", i, expectedArgs[i], recorder.args[i])
+		}
+	}
+}
+
+func TestGetAllCountriesInvalidFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	mockDBPool := &mockPgxPool{}
+
+	router.GET("/api/v1/countries", getAllCountries(mockDBPool.Query))
+
+	for _, query := range []string{"gdp=1", "name__regex=x", "continent_id=abc", "id__ilike=1", "population__ilike=1", "sort=gdp", "sort=id,name"} {
+		req, err := http.NewRequest(http.MethodGet, "/api/v1/countries?"+query, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for '%s', but got %d", http.StatusBadRequest, query, w.Code)
+		}
+	}
+}
+
+func TestGetContinentCountries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	mockDBPool := &mockPgxPool{}
+	recorder := &recordingQuery{}
+
+	router.GET("/api/v1/continents/:id/countries", getContinentCountries(mockDBPool.QueryRow, recorder.Query))
+
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/continents/3/countries?limit=10", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+
+	expectedSQL := "SELECT " + countryColumns + ", id FROM countries WHERE continent_id = $1 ORDER BY id LIMIT $2"
+	if recorder.sql != expectedSQL {
+		t.Errorf("Expected SQL '%s', but got '%s'", expectedSQL, recorder.sql)
+	}
+	if len(recorder.args) != 2 || recorder.args[0] != 3 || recorder.args[1] != 11 {
+		t.Errorf("Expected args [3 11], but got %v", recorder.args)
+	}
+}
+
+func TestGetContinentCountriesParentNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	mockDBPool := &mockPgxPool{}
+
+	router.GET("/api/v1/continents/:id/countries", getContinentCountries(mockQueryRowMissing, mockDBPool.Query))
+
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/continents/3/countries", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestCreateCountryCity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	mockDBPool := &mockPgxPool{}
+
+	router.POST("/api/v1/countries/:id/cities", createCountryCity(mockDBPool.QueryRow))
+
+	body := `{"name":"Paris"}`
+	req, err := http.NewRequest(http.MethodPost, "/api/v1/countries/1/cities", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status code %d, but got %d", http.StatusCreated, w.Code)
+	}
+}
+
+func TestInitializeRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := setup.GetConfig()
+	cfg.PgPool = &mockPgxPool{}
+
+	InitializeRoutes()
+
+	if len(cfg.GinEngine.Routes()) == 0 {
+		t.Errorf("Expected routes to be registered")
+	}
+	for _, route := range cfg.GinEngine.Routes() {
+		if route.Path == "/health" {
+			t.Errorf("Expected the health details to be served only on the admin listener")
+		}
+	}
+}
+
+func TestNoRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := setup.GetConfig()
+	cfg.PgPool = &mockPgxPool{}
+
+	InitializeRoutes()
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/api/v1/nope", http.StatusNotFound},
+		{http.MethodPatch, "/api/v1/continents", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		cfg.GinEngine.ServeHTTP(w, req)
+
+		if w.Code != tt.status || w.Header().Get("Content-Type") != problemContentType {
+			t.Errorf("Expected a %d problem for %s %s, but got %d '%s'", tt.status, tt.method, tt.path, w.Code, w.Header().Get("Content-Type"))
+		}
+		var response Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Status != tt.status {
+			t.Errorf("Expected a problem body, but got %s", w.Body.String())
+		}
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := setup.GetConfig()
+	cfg.PgPool = &mockPgxPool{}
+
+	req, _ := http.NewRequest(http.MethodGet, "/health", nil)
+	w := httptest.NewRecorder()
+	HealthHandler().ServeHTTP(w, req)
+
+	var report healthReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to parse response body: %v", err)
+	}
+	if w.Code != http.StatusServiceUnavailable || report.Components["database"].Error == "" {
+		t.Errorf("Expected the details of the failed database check, but got %d %+v", w.Code, report)
+	}
+}
+
+func TestGetCityExpanded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	queryRow := func(_ context.Context, _ string, _ ...any) pgx.Row {
+		return &mockValueRow{values: []any{7, "Paris", 5}}
+	}
+	var queries []string
+	query := func(_ context.Context, sql string, _ ...any) (pgx.Rows, error) {
+		queries = append(queries, sql)
+		if strings.Contains(sql, "FROM countries") {
+			return &mockValueRows{rows: [][]any{{5, "France", 1}}}, nil
+		}
+		return &mockValueRows{rows: [][]any{{1, "Europe"}}}, nil
+	}
+
+	router.GET("/api/v1/city/:id", getCity(queryRow, query))
+
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/city/7?expand=country.continent", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+
+	var response City
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if len(queries) != 2 {
+		t.Errorf("Expected 2 batched queries, but got %d", len(queries))
+	}
+	if response.Country == nil || response.Country.Name != "France" {
+		t.Fatalf("Expected country 'France' to be expanded, but got %+v", response.Country)
+	}
+	if response.Country.Continent == nil || response.Country.Continent.Name != "Europe" {
+		t.Errorf("Expected continent 'Europe' to be expanded, but got %+v", response.Country.Continent)
+	}
+}
+
+func TestGetAllCitiesInvalidExpand(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	mockDBPool := &mockPgxPool{}
+
+	router.GET("/api/v1/cities", getAllCities(mockDBPool.Query))
+
+	for _, expand := range []string{"continent", "country.continent.cities", "country.name"} {
+		req, err := http.NewRequest(http.MethodGet, "/api/v1/cities?expand="+expand, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for '%s', but got %d", http.StatusBadRequest, expand, w.Code)
+		}
+	}
+}
+
+func TestDeleteContinentNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	execFunc := func(_ context.Context, _ string, _ ...any) (pgconn.CommandTag, error) {
+		return pgconn.NewCommandTag("DELETE 0"), nil
+	}
+	router.DELETE("/api/v1/continent/:id", deleteContinent(execFunc))
+
+	req, err := http.NewRequest(http.MethodDelete, "/api/v1/continent/1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestWriteDBError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		method string
+		err    error
+		status int
+		field  string
+	}{
+		{"no rows", http.MethodGet, pgx.ErrNoRows, http.StatusNotFound, ""},
+		{"missing parent", http.MethodPost, &pgconn.PgError{Code: "23503", TableName: "countries", ConstraintName: "countries_continent_id_fkey"}, http.StatusUnprocessableEntity, "continent_id"},
+		{"still referenced", http.MethodDelete, &pgconn.PgError{Code: "23503", TableName: "countries", ConstraintName: "countries_continent_id_fkey"}, http.StatusConflict, ""},
+		{"duplicate", http.MethodPost, &pgconn.PgError{Code: "23505", TableName: "continents", ConstraintName: "continents_name_key"}, http.StatusConflict, "name"},
+		{"invalid id", http.MethodGet, &pgconn.PgError{Code: "22P02"}, http.StatusBadRequest, ""},
+		{"id out of range", http.MethodGet, &pgconn.PgError{Code: "22003"}, http.StatusBadRequest, ""},
+		{"check", http.MethodPost, &pgconn.PgError{Code: "23514", TableName: "countries", ConstraintName: "countries_area_km2_check"}, http.StatusUnprocessableEntity, "area_km2"},
+		{"other", http.MethodGet, &pgconn.PgError{Code: "XX000", Message: "secret"}, http.StatusInternalServerError, ""},
+		{"statement timeout", http.MethodGet, fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, ""},
+		{"server statement timeout", http.MethodGet, &pgconn.PgError{Code: "57014"}, http.StatusGatewayTimeout, ""},
+		{"canceled", http.MethodGet, fmt.Errorf("query: %w", context.Canceled), http.StatusServiceUnavailable, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(tt.method, "/", nil)
+
+			writeDBError(c, tt.err, "Continent")
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status code %d, but got %d", tt.status, w.Code)
+			}
+
+			if w.Header().Get("Content-Type") != problemContentType {
+				t.Errorf("Expected content type '%s', but got '%s'", problemContentType, w.Header().Get("Content-Type"))
+			}
+
+			var response Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Status != tt.status || response.TraceID == "" {
+				t.Errorf("Expected status %d and a trace id, but got %+v", tt.status, response)
+			}
+			field := ""
+			if len(response.Errors) > 0 {
+				field = response.Errors[0].Field
+			}
+			if field != tt.field {
+				t.Errorf("Expected field '%s', but got '%s'", tt.field, field)
+			}
+		})
+	}
+}
+
+func TestWriteCapitalError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	err := &pgconn.PgError{Code: "23503", TableName: "countries", ConstraintName: "countries_capital_city_id_fkey"}
+
+	tests := []struct {
+		resource string
+		status   int
+		field    string
+	}{
+		{"Country", http.StatusUnprocessableEntity, "capital_city_id"},
+		{"City", http.StatusConflict, ""},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/", nil)
+
+		writeDBError(c, err, tt.resource)
+
+		var response Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		field := ""
+		if len(response.Errors) > 0 {
+			field = response.Errors[0].Field
+		}
+		if w.Code != tt.status || field != tt.field {
+			t.Errorf("Expected status code %d and field '%s' for %s, but got %d %+v", tt.status, tt.field, tt.resource, w.Code, response)
+		}
+	}
+}
+
+func TestCreateCountryValidationProblem(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	mockDBPool := &mockPgxPool{}
+
+	router.POST("/api/v1/country", createCountry(mockDBPool.QueryRow))
+
+	req, err := http.NewRequest(http.MethodPost, "/api/v1/country", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+	if w.Header().Get("Content-Type") != problemContentType {
+		t.Errorf("Expected content type '%s', but got '%s'", problemContentType, w.Header().Get("Content-Type"))
+	}
+
+	var response Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Errors) != 2 || response.Errors[0].Field != "name" || response.Errors[1].Field != "continent_id" {
+		t.Errorf("Expected errors on 'name' and 'continent_id', but got %+v", response.Errors)
+	}
+}
+
+func TestCreateCountryAttributes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	mockDBPool := &mockPgxPool{}
+
+	router.POST("/api/v1/country", createCountry(mockDBPool.QueryRow))
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		field  string
+	}{
+		{"valid", `{"name":"Finland","continent_id":1,"iso_alpha2":"FI","iso_alpha3":"FIN","iso_numeric":"246","population":5600000,"area_km2":338455,"calling_code":"+358","tld":".fi"}`, http.StatusCreated, ""},
+		{"alpha-2", `{"name":"Finland","continent_id":1,"iso_alpha2":"XX"}`, http.StatusBadRequest, "iso_alpha2"},
+		{"lowercase alpha-3", `{"name":"Finland","continent_id":1,"iso_alpha3":"fin"}`, http.StatusBadRequest, "iso_alpha3"},
+		{"numeric", `{"name":"Finland","continent_id":1,"iso_numeric":"1246"}`, http.StatusBadRequest, "iso_numeric"},
+		{"population", `{"name":"Finland","continent_id":1,"population":-1}`, http.StatusBadRequest, "population"},
+		{"calling code", `{"name":"Finland","continent_id":1,"calling_code":"358"}`, http.StatusBadRequest, "calling_code"},
+		{"tld", `{"name":"Finland","continent_id":1,"tld":"fi"}`, http.StatusBadRequest, "tld"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/country", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, but got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.field == "" {
+				return
+			}
+			var response Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if len(response.Errors) != 1 || response.Errors[0].Field != tt.field {
+				t.Errorf("Expected an error on '%s', but got %+v", tt.field, response.Errors)
+			}
+		})
+	}
+}
+
+func TestCreateCityAttributes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	mockDBPool := &mockPgxPool{}
+
+	router.POST("/api/v1/city", createCity(mockDBPool.QueryRow))
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		field  string
+	}{
+		{"valid", `{"name":"Helsinki","country_id":1,"latitude":60.17,"longitude":24.94,"elevation_m":17,"population":674500,"time_zone":"Europe/Helsinki"}`, http.StatusCreated, ""},
+		{"equator", `{"name":"Quito","country_id":1,"latitude":0,"longitude":-78.5}`, http.StatusCreated, ""},
+		{"latitude", `{"name":"Helsinki","country_id":1,"latitude":91,"longitude":24.94}`, http.StatusBadRequest, "latitude"},
+		{"longitude", `{"name":"Helsinki","country_id":1,"latitude":60.17,"longitude":-180.5}`, http.StatusBadRequest, "longitude"},
+		{"latitude alone", `{"name":"Helsinki","country_id":1,"latitude":60.17}`, http.StatusBadRequest, "longitude"},
+		{"population", `{"name":"Helsinki","country_id":1,"population":-5}`, http.StatusBadRequest, "population"},
+		{"time zone", `{"name":"Helsinki","country_id":1,"time_zone":"Europe/Espoo"}`, http.StatusBadRequest, "time_zone"},
+		{"local time zone", `{"name":"Helsinki","country_id":1,"time_zone":"Local"}`, http.StatusBadRequest, "time_zone"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/api/v1/city", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, but got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.field == "" {
+				return
+			}
+			var response Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if len(response.Errors) != 1 || response.Errors[0].Field != tt.field {
+				t.Errorf("Expected an error on '%s', but got %+v", tt.field, response.Errors)
+			}
+		})
+	}
+}
+
+func TestGetAllCitiesByPopulation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	recorder := &recordingQuery{}
+
+	router.GET("/api/v1/cities", getAllCities(recorder.Query))
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/cities?population__gte=100000&sort=-population", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	expectedSQL := "SELECT " + cityColumns + ", COALESCE(population, -1), id FROM cities" +
+		" WHERE population >= $1 ORDER BY COALESCE(population, -1) DESC, id LIMIT $2"
+	if recorder.sql != expectedSQL {
+		t.Errorf("Expected SQL '%s', but got '%s'", expectedSQL, recorder.sql)
+	}
+}
+
+func TestGetNearbyCities(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	recorder := &recordingQuery{}
+
+	router.GET("/api/v1/cities/nearby", getNearbyCities(recorder.Query))
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/cities/nearby?lat=-18.14&lon=178.44&radius_km=1500&limit=5", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	// The circle around Fiji crosses the antimeridian, so there are two
+	// bounding boxes.
+	if strings.Count(recorder.sql, "latitude BETWEEN") != 2 || !strings.Contains(recorder.sql, "ORDER BY distance_km, id LIMIT $12") {
+		t.Errorf("Expected two bounding boxes ordered by distance, but got '%s'", recorder.sql)
+	}
+	if recorder.args[0] != -18.14 || recorder.args[10] != 1500.0 || recorder.args[11] != 5 {
+		t.Errorf("Expected the center, the radius and the limit, but got %v", recorder.args)
+	}
+
+	for _, query := range []string{"lon=2&radius_km=10", "lat=91&lon=2&radius_km=10", "lat=48&lon=2", "lat=48&lon=2&radius_km=5000", "lat=48&lon=2&radius_km=-1"} {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/cities/nearby?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for '%s', but got %d", http.StatusBadRequest, query, w.Code)
+		}
+	}
+}
+
+func TestGetNearestCity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// Only the third circle has a city.
+	var radii []any
+	query := func(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+		radii = append(radii, args[len(args)-2])
+		if len(radii) < 3 {
+			return &mockValueRows{}, nil
+		}
+		return &mockValueRows{rows: [][]any{{7, "Nice", 2, nil, nil, nil, nil, nil, nil, nil, 612.5}}}, nil
+	}
+	router.GET("/api/v1/cities/nearest", getNearestCity(query))
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/cities/nearest?lat=48.85&lon=2.35", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	var response NearbyCity
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.ID != 7 || response.DistanceKm != 612.5 {
+		t.Errorf("Expected city 7 at 612.5 km, but got %+v", response)
+	}
+	if fmt.Sprint(radii) != "[50 200 800]" {
+		t.Errorf("Expected the search radius to grow, but got %v", radii)
+	}
+
+	// Without any city with coordinates the search stops at the size of
+	// the Earth.
+	router = gin.Default()
+	router.GET("/api/v1/cities/nearest", getNearestCity(func(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+		return &mockValueRows{}, nil
+	}))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestGetCityDistance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cities := [][]any{
+		{1, "Helsinki", 1, 60.1699, 24.9384, nil, nil, "Europe/Helsinki"},
+		{2, "Paris", 2, 48.8566, 2.3522, nil, nil, "Europe/Paris"},
+		{3, "Atlantis", 3},
+	}
+	query := func(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+		return &mockValueRows{rows: cities}, nil
+	}
+	router := gin.Default()
+	router.GET("/api/v1/cities/:id/distance/:otherId", getCityDistance(query))
+	router.GET("/api/v1/cities/distances", getDistanceMatrix(query, 3))
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/cities/2/distance/1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	var distance Distance
+	if err := json.Unmarshal(w.Body.Bytes(), &distance); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if distance.From.Name != "Paris" || distance.To.Name != "Helsinki" || int(distance.DistanceKm) != 1908 || int(distance.DistanceMiles) != 1185 {
+		t.Errorf("Expected 1908 km from Paris to Helsinki, but got %+v", distance)
+	}
+	if distance.TimeZoneOffsetHours == nil || *distance.TimeZoneOffsetHours != 1 {
+		t.Errorf("Expected Helsinki to be an hour ahead, but got %v", distance.TimeZoneOffsetHours)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/cities/distances?ids=1,2", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var matrix DistanceMatrix
+	if err := json.Unmarshal(w.Body.Bytes(), &matrix); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(matrix.DistancesKm) != 2 || matrix.DistancesKm[0][0] != 0 || matrix.DistancesKm[0][1] != matrix.DistancesKm[1][0] || int(matrix.DistancesKm[0][1]) != 1908 {
+		t.Errorf("Expected a symmetric matrix, but got %v", matrix.DistancesKm)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/api/v1/cities/1/distance/9", http.StatusNotFound},
+		{"/api/v1/cities/1/distance/3", http.StatusUnprocessableEntity},
+		{"/api/v1/cities/1/distance/x", http.StatusBadRequest},
+		{"/api/v1/cities/distances", http.StatusBadRequest},
+		{"/api/v1/cities/distances?ids=1,2,1,2", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("Expected status code %d for '%s', but got %d", tt.status, tt.path, w.Code)
+		}
+	}
+}
+
+// The image has no zoneinfo, and the host of the tests has, so the test
+// checks that the server links the embedded database instead of loading a
+// zone.
+func TestTimeZoneDataIsEmbedded(t *testing.T) {
+	out, err := exec.Command("go", "list", "-deps", "example.com/api/cmd/api").Output()
+	if err != nil {
+		t.Fatalf("Failed to list the dependencies of the server: %v", err)
+	}
+	if !slices.Contains(strings.Fields(string(out)), "time/tzdata") {
+		t.Errorf("Expected the server to embed time/tzdata")
+	}
+}
+
+func TestOffsetDifferenceHours(t *testing.T) {
+	paris, kolkata, sydney := "Europe/Paris", "Asia/Kolkata", "Australia/Sydney"
+	winter := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	summer := time.Date(2025, 7, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		from, to *string
+		at       time.Time
+		hours    float64
+	}{
+		{&paris, &kolkata, winter, 4.5},
+		{&paris, &kolkata, summer, 3.5},
+		{&paris, &sydney, winter, 10},
+		{&paris, &sydney, summer, 8},
+	}
+	for _, tt := range tests {
+		if hours := offsetDifferenceHours(tt.from, tt.to, tt.at); hours == nil || *hours != tt.hours {
+			t.Errorf("Expected %v hours from %s to %s at %v, but got %v", tt.hours, *tt.from, *tt.to, tt.at, hours)
+		}
+	}
+	if hours := offsetDifferenceHours(&paris, nil, winter); hours != nil {
+		t.Errorf("Expected no difference without a time zone, but got %v", *hours)
+	}
+}
+
+func TestGetCountryByCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	var sql string
+	var args []any
+	queryRow := func(ctx context.Context, query string, queryArgs ...any) pgx.Row {
+		sql, args = query, queryArgs
+		return mockQueryRow(ctx, query, queryArgs...)
+	}
+	router.GET("/api/v1/countries/by-code/:code", getCountryByCode(queryRow, mockQuery))
+
+	tests := []struct {
+		code   string
+		column string
+		value  string
+	}{
+		{"fi", "iso_alpha2", "FI"},
+		{"FIN", "iso_alpha3", "FIN"},
+		{"246", "iso_numeric", "246"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/countries/by-code/"+tt.code, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code %d for '%s', but got %d", http.StatusOK, tt.code, w.Code)
+		}
+		if !strings.HasSuffix(sql, "WHERE "+tt.column+"=$1") || args[0] != tt.value {
+			t.Errorf("Expected a lookup by %s '%s', but got '%s' with %v", tt.column, tt.value, sql, args)
+		}
+	}
+
+	for _, code := range []string{"F1", "FINL", "24"} {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/countries/by-code/"+code, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for '%s', but got %d", http.StatusBadRequest, code, w.Code)
+		}
+	}
+}
+
+func TestGetAllCitiesGeoJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	query := func(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+		return &mockValueRows{rows: [][]any{
+			{7, "Nice", 2, 43.7, 7.26, nil, nil, "Europe/Paris", nil, nil, 7},
+			{8, "Atlantis", 2, nil, nil, nil, nil, nil, nil, nil, 8},
+		}}, nil
+	}
+	router.GET("/api/v1/cities", getAllCities(query))
+
+	for _, header := range []struct{ query, accept string }{{"?format=geojson", ""}, {"", "application/geo+json"}} {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/cities"+header.query, nil)
+		if header.accept != "" {
+			req.Header.Set("Accept", header.accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+		}
+		if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/geo+json") {
+			t.Errorf("Expected a GeoJSON content type, but got '%s'", contentType)
+		}
+
+		var response struct {
+			Type     string `json:"type"`
+			Features []struct {
+				ID       int `json:"id"`
+				Geometry *struct {
+					Type        string    `json:"type"`
+					Coordinates []float64 `json:"coordinates"`
+				} `json:"geometry"`
+				Properties City `json:"properties"`
+			} `json:"features"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response.Type != "FeatureCollection" || len(response.Features) != 2 {
+			t.Fatalf("Expected a collection of two features, but got %s", w.Body.String())
+		}
+		// GeoJSON positions are longitude first.
+		point := response.Features[0].Geometry
+		if point == nil || point.Type != "Point" || len(point.Coordinates) != 2 || point.Coordinates[0] != 7.26 || point.Coordinates[1] != 43.7 {
+			t.Errorf("Expected the point [7.26, 43.7], but got %+v", point)
+		}
+		if response.Features[0].Properties.Name != "Nice" {
+			t.Errorf("Expected the city as the properties, but got %+v", response.Features[0].Properties)
+		}
+		if response.Features[1].Geometry != nil {
+			t.Errorf("Expected no geometry for a city without coordinates, but got %+v", response.Features[1].Geometry)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/cities?format=kml", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestGetCountryBoundary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	// A square with a point which is almost on its bottom edge.
+	boundary := []byte(`{"type":"Polygon","coordinates":[[[0,0],[5,0.01],[10,0],[10,10],[0,10],[0,0]]]}`)
+	var sql string
+	queryRow := func(ctx context.Context, query string, args ...any) pgx.Row {
+		sql = query
+		return &mockValueRow{values: []any{5, "France", 1, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, boundary}}
+	}
+	router.GET("/api/v1/country/:id", getCountry(queryRow, mockQuery))
+
+	tests := []struct {
+		query     string
+		positions int
+	}{
+		{"?format=geojson", 6},
+		{"?format=geojson&tolerance=0.1", 5},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/country/5"+tt.query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if !strings.Contains(sql, ", boundary FROM countries") {
+			t.Errorf("Expected the boundary to be selected, but got '%s'", sql)
+		}
+
+		var response struct {
+			Type     string `json:"type"`
+			Geometry struct {
+				Type        string         `json:"type"`
+				Coordinates [][][2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties Country `json:"properties"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response.Type != "Feature" || response.Geometry.Type != "Polygon" || response.Properties.Name != "France" {
+			t.Errorf("Expected a Polygon feature of France, but got %s", w.Body.String())
+		}
+		if len(response.Geometry.Coordinates) != 1 || len(response.Geometry.Coordinates[0]) != tt.positions {
+			t.Errorf("Expected %d positions for '%s', but got %v", tt.positions, tt.query, response.Geometry.Coordinates)
+		}
+	}
+
+	for _, query := range []string{"?format=geojson&tolerance=-1", "?format=xml"} {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/country/5"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for '%s', but got %d", http.StatusBadRequest, query, w.Code)
+		}
+	}
+
+	// Plain JSON does not read the boundary.
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/country/5", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || strings.Contains(sql, "boundary") || strings.Contains(w.Body.String(), "boundary") {
+		t.Errorf("Expected the country without its boundary, but got %d '%s': %s", w.Code, sql, w.Body.String())
+	}
+}
+
+func TestPutCountryBoundary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	var args []any
+	exec := func(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+		args = arguments
+		if arguments[len(arguments)-1] == "404" {
+			return pgconn.NewCommandTag("UPDATE 0"), nil
+		}
+		return pgconn.NewCommandTag("UPDATE 1"), nil
+	}
+	router.PUT("/api/v1/country/:id/boundary", putCountryBoundary(exec))
+
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		status int
+	}{
+		{"polygon", "5", `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,0]]]}`, http.StatusOK},
+		{"multipolygon", "5", `{"type":"MultiPolygon","coordinates":[[[[0,0],[10,0],[10,10],[0,0]]],[[[20,0],[30,0],[30,10],[20,0]]]]}`, http.StatusOK},
+		{"point", "5", `{"type":"Point","coordinates":[0,0]}`, http.StatusBadRequest},
+		{"open ring", "5", `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10]]]}`, http.StatusBadRequest},
+		{"latitude", "5", `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,95],[0,0]]]}`, http.StatusBadRequest},
+		{"not json", "5", `{"type":`, http.StatusBadRequest},
+		{"not found", "404", `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,0]]]}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args = nil
+			req, _ := http.NewRequest(http.MethodPut, "/api/v1/country/"+tt.id+"/boundary", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status code %d, but got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status == http.StatusBadRequest && args != nil {
+				t.Errorf("Expected an invalid boundary not to be stored, but got %v", args)
+			}
+			if tt.status == http.StatusOK && !strings.HasPrefix(w.Header().Get("Content-Type"), "application/geo+json") {
+				t.Errorf("Expected a GeoJSON content type, but got '%s'", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestSortByNullableField(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	recorder := &recordingQuery{}
+
+	router.GET("/api/v1/countries", getAllCountries(recorder.Query))
+
+	cursor := encodeCursor("-population,id", []any{1000, 3})
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/countries?population__gte=1000&sort=-population&cursor="+cursor, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	expectedSQL := "SELECT " + countryColumns + ", COALESCE(population, -1), id FROM countries" +
+		" WHERE population >= $1 AND ((COALESCE(population, -1) < $2) OR (COALESCE(population, -1) = $3 AND id > $4))" +
+		" ORDER BY COALESCE(population, -1) DESC, id LIMIT $5"
+	if recorder.sql != expectedSQL {
+		t.Errorf("Expected SQL '%s', but got '%s'", expectedSQL, recorder.sql)
+	}
+}
+
+func TestInternalErrorIsMasked(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+
+	queryRow := func(_ context.Context, _ string, _ ...any) pgx.Row {
+		return &mockErrorRow{err: errors.New("connection refused to 10.0.0.1")}
+	}
+	router.GET("/api/v1/continent/:id", getContinent(queryRow))
+
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/continent/1", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, but got %d", http.StatusInternalServerError, w.Code)
+	}
+	if strings.Contains(w.Body.String(), "10.0.0.1") {
+		t.Errorf("Expected internal error to be masked, but got %s", w.Body.String())
+	}
+}
+
+func TestCorsPreflight(t *testing.T) {
+	router := gin.New()
+	router.Use(cors([]string{"https://app.example"}))
+	router.GET("/api/v1/continent", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest(http.MethodOptions, "/api/v1/continent", nil)
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNoContent, w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example" {
+		t.Errorf("Expected the origin to be allowed, but got '%s'", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	for _, header := range []string{"X-API-Key", "X-Request-ID"} {
+		if !strings.Contains(w.Header().Get("Access-Control-Allow-Headers"), header) {
+			t.Errorf("Expected the %s header to be allowed, but got '%s'", header, w.Header().Get("Access-Control-Allow-Headers"))
+		}
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/continent", nil)
+	req.Header.Set("Origin", "https://app.example")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	for _, header := range []string{"Location", "Retry-After", "RateLimit-Remaining", "X-Request-ID"} {
+		if !strings.Contains(w.Header().Get("Access-Control-Expose-Headers"), header) {
+			t.Errorf("Expected the %s header to be exposed, but got '%s'", header, w.Header().Get("Access-Control-Expose-Headers"))
+		}
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/continent", nil)
+	req.Header.Set("Origin", "https://other.example")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected the origin to be rejected")
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var databaseErr error
+	health := &setup.Health{}
+	checks := []setup.HealthCheck{
+		{Name: "database", Check: func(ctx context.Context) (map[string]any, error) {
+			return map[string]any{"max_conns": 10}, databaseErr
+		}},
+	}
+
+	router := gin.New()
+	router.GET("/healthz", liveness())
+	router.GET("/readyz", readiness(health, checks))
+	router.GET("/health", healthDetails(health, checks))
+
+	get := func(path string) (int, healthReport) {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var report healthReport
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("Failed to parse response body: %v", err)
+		}
+		return w.Code, report
+	}
+
+	if code, report := get("/readyz"); code != http.StatusOK || report.Components["database"].Details["max_conns"] != float64(10) {
+		t.Errorf("Expected ready with pool stats, but got %d %+v", code, report)
+	}
+
+	databaseErr = errors.New("connection refused")
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("Expected liveness to pass when the database is down, but got %d", code)
+	}
+	code, report := get("/readyz")
+	if code != http.StatusServiceUnavailable || report.Components["database"].Status != statusDown {
+		t.Errorf("Expected the database to be reported down, but got %d %+v", code, report)
+	}
+	if report.Components["database"].Error != "" {
+		t.Errorf("Expected the public readiness to hide the error, but got '%s'", report.Components["database"].Error)
+	}
+	code, report = get("/health")
+	if code != http.StatusServiceUnavailable || report.Components["database"].Error != "connection refused" {
+		t.Errorf("Expected the database to be reported down, but got %d %+v", code, report)
+	}
+
+	databaseErr = nil
+	health.Drain()
+	if code, report := get("/readyz"); code != http.StatusServiceUnavailable || report.Status != statusDraining {
+		t.Errorf("Expected readiness to fail while draining, but got %d %+v", code, report)
+	}
+}
+
+func TestStartingServer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	health := &setup.Health{}
+	health.SetStarting(true)
+
+	router := gin.New()
+	router.GET("/readyz", readiness(health, nil))
+	router.Use(requireStarted(health))
+	router.GET("/api/v1/continents", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/readyz", "/api/v1/continents"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status code %d for %s, but got %d", http.StatusServiceUnavailable, path, w.Code)
+		}
+	}
+
+	health.SetStarting(false)
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/continents", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestStatementTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(statementTimeout(5*time.Second, map[string]time.Duration{"/api/v1/cities": time.Millisecond}))
+	router.GET("/api/v1/cities", getAllCities(func(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	router.GET("/api/v1/continents", func(c *gin.Context) {
+		deadline, ok := c.Request.Context().Deadline()
+		if !ok || time.Until(deadline) < 4*time.Second {
+			t.Errorf("Expected the default timeout")
+		}
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/cities", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status code %d, but got %d", http.StatusGatewayTimeout, w.Code)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/continents", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestRequestLogging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	router := gin.New()
+	router.Use(requestID(), accessLog(), recovery())
+	router.GET("/api/v1/continent/:id", func(c *gin.Context) { panic("secret") })
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/continent/1", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("Expected a masked 500 response, but got %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Request-ID") != "abc-123" {
+		t.Errorf("Expected the request id to be echoed, but got '%s'", w.Header().Get("X-Request-ID"))
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a panic and an access log line, but got %d lines", len(lines))
+	}
+	var panicLine, accessLine map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &panicLine); err != nil {
+		t.Fatalf("Failed to parse log line: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &accessLine); err != nil {
+		t.Fatalf("Failed to parse log line: %v", err)
+	}
+	if panicLine["error"] != "secret" || !strings.Contains(panicLine["stack"].(string), "runtime/debug.Stack") {
+		t.Errorf("Expected the panic with its stack trace, but got %v", panicLine)
+	}
+	if accessLine["request_id"] != "abc-123" || accessLine["route"] != "/api/v1/continent/:id" || accessLine["status"] != float64(500) {
+		t.Errorf("Expected an access log line for the request, but got %v", accessLine)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/api/v1/continent/1", nil)
+	req.Header.Set("X-Request-ID", "bad id\n")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if id := w.Header().Get("X-Request-ID"); len(id) != 32 {
+		t.Errorf("Expected a generated request id, but got '%s'", id)
+	}
+}
+
+type mockAuthenticator struct {
+	principal *auth.Principal
+	err       error
+}
+
+func (m mockAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*auth.Principal, error) {
+	return m.principal, m.err
+}
+
+func TestAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		authenticators []auth.Authenticator
+		status         int
+	}{
+		{"no credentials", []auth.Authenticator{mockAuthenticator{err: auth.ErrNoCredentials}}, http.StatusUnauthorized},
+		{"invalid", []auth.Authenticator{mockAuthenticator{err: auth.ErrInvalidCredentials}}, http.StatusUnauthorized},
+		{"second accepts", []auth.Authenticator{mockAuthenticator{err: auth.ErrNoCredentials}, mockAuthenticator{principal: &auth.Principal{Subject: "steward"}}}, http.StatusOK},
+		{"keys unavailable", []auth.Authenticator{mockAuthenticator{err: &auth.UnavailableError{Err: errors.New("jwks is down"), RetryAfter: 1500 * time.Millisecond}}}, http.StatusServiceUnavailable},
+		{"failed", []auth.Authenticator{mockAuthenticator{err: errors.New("database is down")}}, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(authenticate(tt.authenticators))
+			router.GET("/api/v1/continents", func(c *gin.Context) { c.String(http.StatusOK, principal(c).Subject) })
+
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/continents", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status code %d, but got %d", tt.status, w.Code)
+			}
+			if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("Expected a WWW-Authenticate header")
+			}
+			if tt.status == http.StatusServiceUnavailable && w.Header().Get("Retry-After") != "2" {
+				t.Errorf("Expected Retry-After 2, but got '%s'", w.Header().Get("Retry-After"))
+			}
+			if tt.status == http.StatusOK && w.Body.String() != "steward" {
+				t.Errorf("Expected the principal in the context, but got '%s'", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Country 7 is on continent 1, and country 8 on continent 2.
+	continentOf := func(ctx context.Context, sql string, args ...any) pgx.Row {
+		if fmt.Sprint(args[0]) == "7" {
+			return &mockValueRow{values: []any{1}}
+		}
+		return &mockValueRow{values: []any{2}}
+	}
+	roleScopes := map[string][]string{"steward-europe": {scopeRead, scopeContinentWrite + "1"}}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		method    string
+		path      string
+		body      string
+		status    int
+	}{
+		{"public", nil, http.MethodDelete, "/api/v1/country/7", "", http.StatusOK},
+		{"read", &auth.Principal{Scopes: []string{scopeRead}}, http.MethodGet, "/api/v1/countries", "", http.StatusOK},
+		{"read cannot write", &auth.Principal{Scopes: []string{scopeRead}}, http.MethodDelete, "/api/v1/country/7", "", http.StatusForbidden},
+		{"admin implies read", &auth.Principal{Scopes: []string{scopeAdmin}}, http.MethodGet, "/api/v1/countries", "", http.StatusOK},
+		{"write", &auth.Principal{Scopes: []string{scopeWrite}}, http.MethodDelete, "/api/v1/country/8", "", http.StatusOK},
+		{"steward role reads", &auth.Principal{Roles: []string{"steward-europe"}}, http.MethodGet, "/api/v1/countries", "", http.StatusOK},
+		{"steward own continent", &auth.Principal{Roles: []string{"steward-europe"}}, http.MethodPut, "/api/v1/country/7", `{"name":"France","continent_id":1}`, http.StatusOK},
+		{"steward moves away", &auth.Principal{Roles: []string{"steward-europe"}}, http.MethodPut, "/api/v1/country/7", `{"name":"France","continent_id":2}`, http.StatusForbidden},
+		{"steward other continent", &auth.Principal{Roles: []string{"steward-europe"}}, http.MethodDelete, "/api/v1/country/8", "", http.StatusForbidden},
+		{"steward creates", &auth.Principal{Roles: []string{"steward-europe"}}, http.MethodPost, "/api/v1/country", `{"name":"Spain","continent_id":1}`, http.StatusOK},
+		{"steward body too large", &auth.Principal{Roles: []string{"steward-europe"}}, http.MethodPut, "/api/v1/country/7", strings.Repeat(" ", maxBoundaryBytes) + `{"continent_id":2}`, http.StatusRequestEntityTooLarge},
+		{"no roles", &auth.Principal{}, http.MethodGet, "/api/v1/countries", "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				if tt.principal != nil {
+					c.Set(principalKey, tt.principal)
+				}
+			})
+			read := authorize(roleScopes, policy{scopes: []string{scopeRead}})
+			writeCountry := authorize(roleScopes, policy{scopes: []string{scopeWrite}, continents: countryContinents(continentOf)})
+			handler := func(c *gin.Context) {
+				body, _ := io.ReadAll(c.Request.Body)
+				c.String(http.StatusOK, string(body))
+			}
+			router.GET("/api/v1/countries", read, handler)
+			router.POST("/api/v1/country", writeCountry, handler)
+			router.PUT("/api/v1/country/:id", writeCountry, handler)
+			router.DELETE("/api/v1/country/:id", writeCountry, handler)
+
+			req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status code %d, but got %d", tt.status, w.Code)
+			}
+			if w.Code == http.StatusOK && w.Body.String() != tt.body {
+				t.Errorf("Expected the handler to get the body, but got '%s'", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(limitAddress(ratelimit.NewMemoryStore(), ratelimit.Limit{Rate: 1, Burst: 3}, map[string]int{"/api/v1/cities": 2}, false))
+	router.GET("/api/v1/cities", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/api/v1/continents", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("/api/v1/cities")
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "3" || w.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("Expected the route to cost 2 tokens, but got %d with %v", w.Code, w.Header())
+	}
+
+	w = request("/api/v1/cities")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" || w.Header().Get("Content-Type") != problemContentType {
+		t.Errorf("Expected a problem with Retry-After, but got %v", w.Header())
+	}
+
+	if w := request("/api/v1/continents"); w.Code != http.StatusOK {
+		t.Errorf("Expected the remaining token to allow a cheaper route, but got %d", w.Code)
+	}
+}
+
+func TestRateLimitAuthenticated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store, limit, costs := ratelimit.NewMemoryStore(), ratelimit.Limit{Rate: 1, Burst: 3}, map[string]int{"/api/v1/cities": 2}
+	router := gin.New()
+	router.Use(limitAddress(store, limit, costs, true))
+	router.Use(func(c *gin.Context) {
+		if key := c.GetHeader("X-Test-Subject"); key != "invalid" {
+			c.Set(principalKey, &auth.Principal{Subject: key, Method: auth.MethodAPIKey})
+			return
+		}
+		writeProblem(c, http.StatusUnauthorized, "Invalid credentials")
+	})
+	router.Use(limitPrincipal(store, limit, costs))
+	router.GET("/api/v1/cities", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/api/v1/continents", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(path, address, subject string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = address + ":1234"
+		req.Header.Set("X-Test-Subject", subject)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The requests which fail the authentication take tokens of their
+	// address, and are rejected before the authentication once it is empty.
+	for range 3 {
+		if w := request("/api/v1/continents", "192.0.2.2", "invalid"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusUnauthorized, w.Code)
+		}
+	}
+	if w := request("/api/v1/continents", "192.0.2.2", "invalid"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the invalid credentials to be limited, but got %d", w.Code)
+	}
+
+	// The API keys behind one address have their own buckets.
+	for _, key := range []string{"first", "second"} {
+		if w := request("/api/v1/cities", "192.0.2.3", key); w.Code != http.StatusOK || w.Header().Get("RateLimit-Remaining") != "1" {
+			t.Errorf("Expected the API key %s to have its own bucket, but got %d with %v", key, w.Code, w.Header())
+		}
+	}
+	if w := request("/api/v1/cities", "192.0.2.4", "first"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the API key to be limited on another address, but got %d", w.Code)
+	}
+
+	// The headers report the tighter bucket.
+	for range 2 {
+		request("/api/v1/continents", "192.0.2.5", "invalid")
+	}
+	if w := request("/api/v1/continents", "192.0.2.5", "third"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("Expected the address bucket to be reported, but got %d with %v", w.Code, w.Header())
+	}
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	request := func(router *gin.Engine, forwardedFor string) int {
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/cities", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Without trusted proxies, a client cannot get a new bucket by sending
+	// another address.
+	router := newEngine(nil)
+	router.Use(limitAddress(ratelimit.NewMemoryStore(), ratelimit.Limit{Rate: 1, Burst: 1}, nil, false))
+	router.GET("/api/v1/cities", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	if code := request(router, "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, code)
+	}
+	if code := request(router, "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d with a spoofed address, but got %d", http.StatusTooManyRequests, code)
+	}
+
+	// Behind a trusted proxy, the forwarded addresses are the clients.
+	router = newEngine([]string{"192.0.2.1"})
+	router.Use(limitAddress(ratelimit.NewMemoryStore(), ratelimit.Limit{Rate: 1, Burst: 1}, nil, false))
+	router.GET("/api/v1/cities", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, address := range []string{"198.51.100.1", "198.51.100.2"} {
+		if code := request(router, address); code != http.StatusOK {
+			t.Errorf("Expected status code %d for %s, but got %d", http.StatusOK, address, code)
+		}
+	}
+}
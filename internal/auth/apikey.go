@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+	apiKeyPrefix = "atlas_"
+)
+
+// APIKey is a stored API key. Only the hash of the key is stored, and the
+// prefix identifies the key in listings.
+type APIKey struct {
+	ID        int
+	Name      string
+	Prefix    string
+	Scopes    []string
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+type DB interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// NewAPIKey generates a key with 256 bits of randomness. A fast hash is
+// enough for keys which cannot be guessed, and it allows the lookup by
+// hash.
+func NewAPIKey() (key string, prefix string, hash string) {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:len(apiKeyPrefix)+8], hashAPIKey(key)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey stores a new key and returns it. The key cannot be read
+// again later.
+func CreateAPIKey(ctx context.Context, db DB, name string, scopes []string) (string, APIKey, error) {
+	key, prefix, hash := NewAPIKey()
+	apiKey := APIKey{Name: name, Prefix: prefix, Scopes: scopes}
+	if apiKey.Scopes == nil {
+		apiKey.Scopes = []string{}
+	}
+	err := db.QueryRow(ctx, "INSERT INTO api_keys (name, prefix, key_hash, scopes) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		name, prefix, hash, apiKey.Scopes).Scan(&apiKey.ID, &apiKey.CreatedAt)
+	return key, apiKey, err
+}
+
+func ListAPIKeys(ctx context.Context, db DB) ([]APIKey, error) {
+	rows, err := db.Query(ctx, "SELECT id, name, prefix, scopes, created_at, revoked_at FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func RevokeAPIKey(ctx context.Context, db DB, name string) error {
+	tag, err := db.Exec(ctx, "UPDATE api_keys SET revoked_at = now() WHERE name = $1 AND revoked_at IS NULL", name)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("no active API key named %s", name)
+	}
+	return nil
+}
+
+// APIKeyAuthenticator authenticates the X-API-Key header against the
+// stored keys which have not been revoked.
+type APIKeyAuthenticator struct {
+	QueryRow func(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidCredentials
+	}
+
+	principal := Principal{Method: MethodAPIKey}
+	err := a.QueryRow(ctx, "SELECT name, scopes FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL", hashAPIKey(key)).
+		Scan(&principal.Subject, &principal.Scopes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &principal, nil
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	ModeNone   = "none"
+	ModeAPIKey = "api_key"
+	ModeJWT    = "jwt"
+)
+
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+var (
+	// ErrNoCredentials means that the request has no credentials for the
+	// authenticator, so the next one can be tried.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials means that the credentials were rejected.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// UnavailableError means that the credentials cannot be checked now,
+// because the keys of the issuer cannot be read. The next attempt is made
+// after RetryAfter.
+type UnavailableError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("the signing keys are unavailable: %v", e.Err)
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Principal is the authenticated caller.
+type Principal struct {
+	Subject string
+	Method  string
+	Scopes  []string
+	Roles   []string
+}
+
+// Authenticator authenticates a request with one kind of credentials.
+type Authenticator interface {
+	Authenticate(ctx context.Context, r *http.Request) (*Principal, error)
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minJWKSRefresh limits how often an unknown key id fetches the keys again,
+// so tokens with random key ids cannot flood the issuer.
+const minJWKSRefresh = time.Minute
+
+// The attempts to reach an issuer which is down are spaced from
+// minRetryBackoff, doubling up to maxRetryBackoff, and the requests in
+// between fail fast instead of waiting for an attempt each.
+const (
+	minRetryBackoff = time.Second
+	maxRetryBackoff = time.Minute
+)
+
+type retryBackoff struct {
+	delay   time.Duration
+	retryAt time.Time
+	err     error
+}
+
+func (b *retryBackoff) failed(err error) {
+	b.delay = min(max(2*b.delay, minRetryBackoff), maxRetryBackoff)
+	b.retryAt = time.Now().Add(b.delay)
+	b.err = err
+}
+
+// unavailable returns the error of the last attempt until the next one.
+func (b *retryBackoff) unavailable() *UnavailableError {
+	if wait := time.Until(b.retryAt); wait > 0 {
+		return &UnavailableError{Err: b.err, RetryAfter: wait}
+	}
+	return nil
+}
+
+// JWKS caches the signing keys of an issuer. The keys are fetched again
+// when they are older than the refresh interval, or when a token has an
+// unknown key id, which happens after the issuer rotates its keys. The
+// source is an http(s) URL, or a local file for tests and offline use.
+type JWKS struct {
+	source  string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+	backoff   retryBackoff
+}
+
+func NewJWKS(source string, refresh time.Duration) *JWKS {
+	return &JWKS{
+		source:  source,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Key returns the public key with the key id.
+func (j *JWKS) Key(ctx context.Context, kid string) (any, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.keys == nil {
+		if err := j.backoff.unavailable(); err != nil {
+			return nil, err
+		}
+	}
+
+	age := time.Since(j.fetchedAt)
+	_, known := j.keys[kid]
+	if j.keys == nil || age > j.refresh || (!known && age > minJWKSRefresh) {
+		if err := j.fetch(ctx); err != nil {
+			if j.keys == nil {
+				j.backoff.failed(err)
+				return nil, &UnavailableError{Err: err, RetryAfter: j.backoff.delay}
+			}
+			// The cached keys are still used while the issuer is down.
+			slog.Warn("Failed to refresh the JWKS", "source", j.source, "error", err)
+		}
+	}
+
+	key, ok := j.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidCredentials, kid)
+	}
+	return key, nil
+}
+
+func (j *JWKS) fetch(ctx context.Context) error {
+	j.fetchedAt = time.Now()
+
+	body, err := j.read(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS from %s: %w", j.source, err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return fmt.Errorf("invalid JWKS from %s: %w", j.source, err)
+	}
+
+	keys := map[string]any{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			slog.Warn("Skipping JWK", "kid", k.Kid, "error", err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	j.keys = keys
+	return nil
+}
+
+func (j *JWKS) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(j.source, "file://"))
+	}
+	return httpGet(ctx, j.client, j.source)
+}
+
+func httpGet(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// DiscoverJWKS reads the jwks_uri from the OpenID configuration of the
+// issuer.
+func DiscoverJWKS(ctx context.Context, issuer string) (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	body, err := httpGet(ctx, client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+	if err != nil {
+		return "", fmt.Errorf("failed to discover the JWKS of %s: %w", issuer, err)
+	}
+
+	var configuration struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(body, &configuration); err != nil || configuration.JWKSURI == "" {
+		return "", fmt.Errorf("the OpenID configuration of %s has no jwks_uri", issuer)
+	}
+	return configuration.JWKSURI, nil
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
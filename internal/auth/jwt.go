@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// JWTAuthenticator validates bearer tokens which are signed by the keys of
+// the issuer. The JWKS is discovered from the issuer unless it is given.
+type JWTAuthenticator struct {
+	Issuer   string
+	Audience string
+	JWKSURL  string
+	Refresh  time.Duration
+
+	mu          sync.Mutex
+	jwks        *JWKS
+	discovering bool
+	backoff     retryBackoff
+}
+
+// claims holds the standard claims, and the scopes and roles in the shapes
+// used by Keycloak and the other common issuers.
+type claims struct {
+	jwt.RegisteredClaims
+	Scope       string   `json:"scope"`
+	Scp         []string `json:"scp"`
+	Roles       []string `json:"roles"`
+	RealmAccess struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, ErrNoCredentials
+	}
+
+	jwks, err := a.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if a.Issuer != "" {
+		options = append(options, jwt.WithIssuer(a.Issuer))
+	}
+	if a.Audience != "" {
+		options = append(options, jwt.WithAudience(a.Audience))
+	}
+
+	var c claims
+	var keyErr error
+	_, err = jwt.ParseWithClaims(strings.TrimSpace(token), &c, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := jwks.Key(ctx, kid)
+		if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+			keyErr = err
+		}
+		return key, err
+	}, options...)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	principal := &Principal{Subject: c.Subject, Method: MethodJWT, Scopes: c.Scp}
+	principal.Scopes = append(principal.Scopes, strings.Fields(c.Scope)...)
+	principal.Roles = append(c.Roles, c.RealmAccess.Roles...)
+	return principal, nil
+}
+
+// keys discovers the JWKS on the first request. While the issuer is not
+// reachable, the discovery is retried with a backoff, and the requests
+// during an attempt do not wait for it.
+func (a *JWTAuthenticator) keys(ctx context.Context) (*JWKS, error) {
+	a.mu.Lock()
+	if a.jwks != nil {
+		defer a.mu.Unlock()
+		return a.jwks, nil
+	}
+	if a.JWKSURL != "" {
+		defer a.mu.Unlock()
+		a.jwks = NewJWKS(a.JWKSURL, a.Refresh)
+		return a.jwks, nil
+	}
+	if a.discovering {
+		a.mu.Unlock()
+		return nil, &UnavailableError{Err: fmt.Errorf("discovering the JWKS of %s", a.Issuer), RetryAfter: minRetryBackoff}
+	}
+	if err := a.backoff.unavailable(); err != nil {
+		a.mu.Unlock()
+		return nil, err
+	}
+	a.discovering = true
+	a.mu.Unlock()
+
+	source, err := DiscoverJWKS(ctx, a.Issuer)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.discovering = false
+	if err != nil {
+		a.backoff.failed(err)
+		return nil, &UnavailableError{Err: err, RetryAfter: a.backoff.delay}
+	}
+	a.jwks = NewJWKS(source, a.Refresh)
+	return a.jwks, nil
+}
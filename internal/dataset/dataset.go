@@ -0,0 +1,80 @@
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"example.com/api/internal/api"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+const (
+	ResourceContinents = "continents"
+	ResourceCountries  = "countries"
+	ResourceCities     = "cities"
+	ResourceAll        = "all"
+)
+
+// Dataset is the export and import representation of the atlas. The ids
+// are preserved, so it can be used for backup and restore.
+type Dataset struct {
+	Continents []api.Continent `json:"continents,omitempty"`
+	Countries  []Country       `json:"countries,omitempty"`
+	Cities     []api.City      `json:"cities,omitempty"`
+}
+
+// Country adds the boundary, which the API only returns as the geometry of
+// a GeoJSON feature, to the country of the API. The CSV files leave it out.
+type Country struct {
+	api.Country
+	Boundary json.RawMessage `json:"boundary,omitempty"`
+}
+
+func (c Country) hasBoundary() bool {
+	return len(c.Boundary) > 0 && string(c.Boundary) != "null"
+}
+
+// boundary is the argument of the boundary column, NULL without one.
+func (c Country) boundary() *string {
+	if !c.hasBoundary() {
+		return nil
+	}
+	boundary := string(c.Boundary)
+	return &boundary
+}
+
+type DB interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func ValidateFormat(format string, resource string) error {
+	switch resource {
+	case ResourceContinents, ResourceCountries, ResourceCities, ResourceAll:
+	default:
+		return fmt.Errorf("resource must be one of %s, %s, %s or %s", ResourceContinents, ResourceCountries, ResourceCities, ResourceAll)
+	}
+
+	switch format {
+	case FormatJSON:
+	case FormatCSV:
+		if resource == ResourceAll {
+			return fmt.Errorf("csv format needs a single resource")
+		}
+	default:
+		return fmt.Errorf("format must be %s or %s", FormatJSON, FormatCSV)
+	}
+	return nil
+}
+
+func includes(resource string, name string) bool {
+	return resource == ResourceAll || resource == name
+}
@@ -0,0 +1,189 @@
+package dataset
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/api/internal/api"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestValidateFormat(t *testing.T) {
+	tests := []struct {
+		format   string
+		resource string
+		valid    bool
+	}{
+		{FormatJSON, ResourceAll, true},
+		{FormatJSON, ResourceCities, true},
+		{FormatCSV, ResourceCountries, true},
+		{FormatCSV, ResourceAll, false},
+		{"xml", ResourceCities, false},
+		{FormatJSON, "planets", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateFormat(tt.format, tt.resource)
+		if (err == nil) != tt.valid {
+			t.Errorf("Expected %s/%s valid=%v, but got error %v", tt.format, tt.resource, tt.valid, err)
+		}
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	latitude, longitude, timeZone := 48.8566, 2.3522, "Europe/Paris"
+	ds := Dataset{Cities: []api.City{
+		{ID: 1, Name: "Paris", CountryID: 2, Latitude: &latitude, Longitude: &longitude, TimeZone: &timeZone, CreatedAt: createdAt, UpdatedAt: createdAt},
+		{ID: 2, Name: "Saint-Étienne, Loire", CountryID: 2, CreatedAt: createdAt, UpdatedAt: createdAt},
+	}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, ds, FormatCSV, ResourceCities); err != nil {
+		t.Fatalf("Failed to write csv: %v", err)
+	}
+
+	read, err := Read(&buf, FormatCSV, ResourceCities)
+	if err != nil {
+		t.Fatalf("Failed to read csv: %v", err)
+	}
+
+	if len(read.Cities) != 2 {
+		t.Fatalf("Expected 2 cities, but got %d", len(read.Cities))
+	}
+	for i := range ds.Cities {
+		if !reflect.DeepEqual(read.Cities[i], ds.Cities[i]) {
+			t.Errorf("Expected city %+v, but got %+v", ds.Cities[i], read.Cities[i])
+		}
+	}
+}
+
+func TestCountryCSVRoundTrip(t *testing.T) {
+	code, population, area := "FI", int64(5600000), 338455.5
+	ds := Dataset{Countries: []Country{
+		{Country: api.Country{ID: 1, Name: "Finland", ContinentID: 1, ISOAlpha2: &code, Population: &population, AreaKm2: &area}},
+		{Country: api.Country{ID: 2, Name: "Atlantis", ContinentID: 1}},
+	}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, ds, FormatCSV, ResourceCountries); err != nil {
+		t.Fatalf("Failed to write csv: %v", err)
+	}
+	read, err := Read(&buf, FormatCSV, ResourceCountries)
+	if err != nil {
+		t.Fatalf("Failed to read csv: %v", err)
+	}
+	if !reflect.DeepEqual(read.Countries, ds.Countries) {
+		t.Errorf("Expected countries %+v, but got %+v", ds.Countries, read.Countries)
+	}
+
+	// The files exported before the optional columns were added.
+	read, err = Read(strings.NewReader("id,name,continent_id,created_at,updated_at\n1,Finland,1,,\n"), FormatCSV, ResourceCountries)
+	if err != nil || len(read.Countries) != 1 || read.Countries[0].ISOAlpha2 != nil {
+		t.Errorf("Expected to read the old header, but got %+v, %v", read.Countries, err)
+	}
+}
+
+func TestCountryJSONBoundary(t *testing.T) {
+	boundary := json.RawMessage(`{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`)
+	ds := Dataset{Countries: []Country{{Country: api.Country{ID: 1, Name: "Finland", ContinentID: 1}, Boundary: boundary}}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, ds, FormatJSON, ResourceAll); err != nil {
+		t.Fatalf("Failed to write json: %v", err)
+	}
+	var raw struct {
+		Countries []map[string]any `json:"countries"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &raw); err != nil || len(raw.Countries) != 1 || raw.Countries[0]["name"] != "Finland" || raw.Countries[0]["boundary"] == nil {
+		t.Errorf("Expected the country fields next to the boundary, but got %s", buf.String())
+	}
+
+	read, err := Read(&buf, FormatJSON, ResourceAll)
+	if err != nil {
+		t.Fatalf("Failed to read json: %v", err)
+	}
+	var compact bytes.Buffer
+	if len(read.Countries) == 1 {
+		_ = json.Compact(&compact, read.Countries[0].Boundary)
+	}
+	if len(read.Countries) != 1 || read.Countries[0].Name != "Finland" || compact.String() != string(boundary) {
+		t.Errorf("Expected the country with its boundary, but got %+v", read.Countries)
+	}
+}
+
+type recordingDB struct {
+	execs int
+}
+
+func (db *recordingDB) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	db.execs++
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+func (db *recordingDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return nil
+}
+
+func (db *recordingDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, nil
+}
+
+func TestStoreInvalidBoundary(t *testing.T) {
+	ds := Dataset{Countries: []Country{
+		{Country: api.Country{ID: 1, Name: "Finland", ContinentID: 1}, Boundary: json.RawMessage(`null`)},
+		{Country: api.Country{ID: 2, Name: "Atlantis", ContinentID: 1}, Boundary: json.RawMessage(`{"type":"Polygon","coordinates":[[[0,0],[1,0],[0,0]]]}`)},
+	}}
+
+	db := &recordingDB{}
+	err := Store(context.Background(), db, ds)
+	if err == nil || !strings.Contains(err.Error(), "country row 2 (id 2)") {
+		t.Errorf("Expected the invalid boundary of the second row to be rejected, but got %v", err)
+	}
+	if db.execs != 0 {
+		t.Errorf("Expected nothing to be written, but got %d statements", db.execs)
+	}
+
+	ds.Countries = ds.Countries[:1]
+	if err := Store(context.Background(), db, ds); err != nil || db.execs == 0 {
+		t.Errorf("Expected a null boundary to be stored, but got %v", err)
+	}
+}
+
+func TestReadCSVInvalid(t *testing.T) {
+	tests := map[string]string{
+		"wrong header": "id,title\n1,Europe\n",
+		"bad id":       "id,name,created_at,updated_at\nx,Europe,,\n",
+		"bad time":     "id,name,created_at,updated_at\n1,Europe,yesterday,\n",
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Read(strings.NewReader(input), FormatCSV, ResourceContinents); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
+
+func TestReadSeed(t *testing.T) {
+	seed, err := ReadSeed(strings.NewReader(`{"continents":[{"name":"Europe","countries":[{"name":"France","cities":[{"name":"Paris"}]}]}]}`))
+	if err != nil {
+		t.Fatalf("Failed to read seed: %v", err)
+	}
+	if seed.Continents[0].Countries[0].Cities[0].Name != "Paris" {
+		t.Errorf("Expected city 'Paris', but got %+v", seed)
+	}
+
+	for _, input := range []string{`{"continents":[{"name":""}]}`, `{"planets":[]}`, `not json`} {
+		if _, err := ReadSeed(strings.NewReader(input)); err == nil {
+			t.Errorf("Expected an error for %s", input)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package dataset
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"example.com/api/internal/api"
+)
+
+var csvHeaders = map[string][]string{
+	ResourceContinents: {"id", "name", "created_at", "updated_at"},
+	ResourceCountries: {
+		"id", "name", "continent_id", "iso_alpha2", "iso_alpha3", "iso_numeric", "official_name", "capital_city_id",
+		"population", "area_km2", "calling_code", "tld", "created_at", "updated_at",
+	},
+	ResourceCities: {
+		"id", "name", "country_id", "latitude", "longitude", "elevation_m", "population", "time_zone", "created_at", "updated_at",
+	},
+}
+
+// Load reads the resource, or all resources, ordered by id.
+func Load(ctx context.Context, db DB, resource string) (Dataset, error) {
+	var ds Dataset
+
+	if includes(resource, ResourceContinents) {
+		rows, err := db.Query(ctx, "SELECT id, name, created_at, updated_at FROM continents ORDER BY id")
+		if err != nil {
+			return ds, err
+		}
+		for rows.Next() {
+			var c api.Continent
+			if err := rows.Scan(&c.ID, &c.Name, &c.CreatedAt, &c.UpdatedAt); err != nil {
+				rows.Close()
+				return ds, err
+			}
+			ds.Continents = append(ds.Continents, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return ds, err
+		}
+	}
+
+	if includes(resource, ResourceCountries) {
+		rows, err := db.Query(ctx, `SELECT id, name, continent_id, iso_alpha2, iso_alpha3, iso_numeric, official_name, capital_city_id,
+			population, area_km2, calling_code, tld, created_at, updated_at, boundary FROM countries ORDER BY id`)
+		if err != nil {
+			return ds, err
+		}
+		for rows.Next() {
+			var c Country
+			err := rows.Scan(&c.ID, &c.Name, &c.ContinentID, &c.ISOAlpha2, &c.ISOAlpha3, &c.ISONumeric, &c.OfficialName, &c.CapitalCityID,
+				&c.Population, &c.AreaKm2, &c.CallingCode, &c.TLD, &c.CreatedAt, &c.UpdatedAt, &c.Boundary)
+			if err != nil {
+				rows.Close()
+				return ds, err
+			}
+			ds.Countries = append(ds.Countries, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return ds, err
+		}
+	}
+
+	if includes(resource, ResourceCities) {
+		rows, err := db.Query(ctx, `SELECT id, name, country_id, latitude, longitude, elevation_m, population, time_zone,
+			created_at, updated_at FROM cities ORDER BY id`)
+		if err != nil {
+			return ds, err
+		}
+		for rows.Next() {
+			var c api.City
+			err := rows.Scan(&c.ID, &c.Name, &c.CountryID, &c.Latitude, &c.Longitude, &c.ElevationM, &c.Population, &c.TimeZone,
+				&c.CreatedAt, &c.UpdatedAt)
+			if err != nil {
+				rows.Close()
+				return ds, err
+			}
+			ds.Cities = append(ds.Cities, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return ds, err
+		}
+	}
+
+	return ds, nil
+}
+
+// Write encodes the dataset in the given format. The csv format has a
+// header row and holds a single resource.
+func Write(w io.Writer, ds Dataset, format string, resource string) error {
+	if format == FormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(ds)
+	}
+
+	records := [][]string{csvHeaders[resource]}
+	switch resource {
+	case ResourceContinents:
+		for _, c := range ds.Continents {
+			records = append(records, []string{strconv.Itoa(c.ID), c.Name, formatTime(c.CreatedAt), formatTime(c.UpdatedAt)})
+		}
+	case ResourceCountries:
+		for _, c := range ds.Countries {
+			records = append(records, []string{
+				strconv.Itoa(c.ID), c.Name, strconv.Itoa(c.ContinentID), formatOptional(c.ISOAlpha2), formatOptional(c.ISOAlpha3),
+				formatOptional(c.ISONumeric), formatOptional(c.OfficialName), formatOptional(c.CapitalCityID), formatOptional(c.Population),
+				formatOptional(c.AreaKm2), formatOptional(c.CallingCode), formatOptional(c.TLD), formatTime(c.CreatedAt), formatTime(c.UpdatedAt),
+			})
+		}
+	case ResourceCities:
+		for _, c := range ds.Cities {
+			records = append(records, []string{
+				strconv.Itoa(c.ID), c.Name, strconv.Itoa(c.CountryID), formatOptional(c.Latitude), formatOptional(c.Longitude),
+				formatOptional(c.ElevationM), formatOptional(c.Population), formatOptional(c.TimeZone), formatTime(c.CreatedAt), formatTime(c.UpdatedAt),
+			})
+		}
+	}
+
+	return csv.NewWriter(w).WriteAll(records)
+}
+
+// formatOptional writes null as an empty field.
+func formatOptional[T string | int | int64 | float64](value *T) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(*value)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,281 @@
+package dataset
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	"example.com/api/internal/api"
+	"example.com/api/internal/geo"
+)
+
+// Read decodes a dataset which has been written by Write. In csv only the
+// id, the name and the parent id columns are required.
+func Read(r io.Reader, format string, resource string) (Dataset, error) {
+	var ds Dataset
+
+	if format == FormatJSON {
+		if err := json.NewDecoder(r).Decode(&ds); err != nil {
+			return ds, fmt.Errorf("invalid json: %w", err)
+		}
+		if !includes(resource, ResourceContinents) {
+			ds.Continents = nil
+		}
+		if !includes(resource, ResourceCountries) {
+			ds.Countries = nil
+		}
+		if !includes(resource, ResourceCities) {
+			ds.Cities = nil
+		}
+		return ds, nil
+	}
+
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return ds, fmt.Errorf("invalid csv: %w", err)
+	}
+	columns, err := csvColumns(records, resource)
+	if err != nil {
+		return ds, err
+	}
+
+	for i, record := range records[1:] {
+		line := i + 2
+		field := func(name string) string {
+			if index, ok := columns[name]; ok {
+				return record[index]
+			}
+			return ""
+		}
+
+		id, err := strconv.Atoi(field("id"))
+		if err != nil {
+			return ds, fmt.Errorf("line %d: id must be an integer", line)
+		}
+		createdAt, updatedAt, err := parseTimes(field("created_at"), field("updated_at"))
+		if err != nil {
+			return ds, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		switch resource {
+		case ResourceContinents:
+			ds.Continents = append(ds.Continents, api.Continent{ID: id, Name: field("name"), CreatedAt: createdAt, UpdatedAt: updatedAt})
+		case ResourceCountries:
+			country, err := parseCountry(field)
+			if err != nil {
+				return ds, fmt.Errorf("line %d: %w", line, err)
+			}
+			country.ID, country.CreatedAt, country.UpdatedAt = id, createdAt, updatedAt
+			ds.Countries = append(ds.Countries, Country{Country: country})
+		case ResourceCities:
+			city, err := parseCity(field)
+			if err != nil {
+				return ds, fmt.Errorf("line %d: %w", line, err)
+			}
+			city.ID, city.CreatedAt, city.UpdatedAt = id, createdAt, updatedAt
+			ds.Cities = append(ds.Cities, city)
+		}
+	}
+
+	return ds, nil
+}
+
+var csvRequired = map[string][]string{
+	ResourceContinents: {"id", "name"},
+	ResourceCountries:  {"id", "name", "continent_id"},
+	ResourceCities:     {"id", "name", "country_id"},
+}
+
+// csvColumns returns the index of each column of the header. The columns
+// can be in any order, and the optional ones can be left out, so the files
+// exported before a column was added can still be read.
+func csvColumns(records [][]string, resource string) (map[string]int, error) {
+	headerErr := fmt.Errorf("csv header must have the columns %v", csvHeaders[resource])
+	if len(records) == 0 {
+		return nil, headerErr
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		if !slices.Contains(csvHeaders[resource], name) {
+			return nil, headerErr
+		}
+		columns[name] = i
+	}
+	for _, name := range csvRequired[resource] {
+		if _, ok := columns[name]; !ok {
+			return nil, headerErr
+		}
+	}
+	return columns, nil
+}
+
+func parseCountry(field func(name string) string) (api.Country, error) {
+	country := api.Country{
+		Name:         field("name"),
+		ISOAlpha2:    optionalString(field("iso_alpha2")),
+		ISOAlpha3:    optionalString(field("iso_alpha3")),
+		ISONumeric:   optionalString(field("iso_numeric")),
+		OfficialName: optionalString(field("official_name")),
+		CallingCode:  optionalString(field("calling_code")),
+		TLD:          optionalString(field("tld")),
+	}
+
+	var err error
+	if country.ContinentID, err = strconv.Atoi(field("continent_id")); err != nil {
+		return country, fmt.Errorf("continent_id must be an integer")
+	}
+	if country.CapitalCityID, err = optionalNumber(field("capital_city_id"), strconv.Atoi); err != nil {
+		return country, fmt.Errorf("capital_city_id must be an integer")
+	}
+	if country.Population, err = optionalNumber(field("population"), func(s string) (int64, error) { return strconv.ParseInt(s, 10, 64) }); err != nil {
+		return country, fmt.Errorf("population must be an integer")
+	}
+	if country.AreaKm2, err = optionalNumber(field("area_km2"), func(s string) (float64, error) { return strconv.ParseFloat(s, 64) }); err != nil {
+		return country, fmt.Errorf("area_km2 must be a number")
+	}
+	return country, nil
+}
+
+func parseCity(field func(name string) string) (api.City, error) {
+	city := api.City{Name: field("name"), TimeZone: optionalString(field("time_zone"))}
+	parseFloat := func(s string) (float64, error) { return strconv.ParseFloat(s, 64) }
+
+	var err error
+	if city.CountryID, err = strconv.Atoi(field("country_id")); err != nil {
+		return city, fmt.Errorf("country_id must be an integer")
+	}
+	if city.Latitude, err = optionalNumber(field("latitude"), parseFloat); err != nil {
+		return city, fmt.Errorf("latitude must be a number")
+	}
+	if city.Longitude, err = optionalNumber(field("longitude"), parseFloat); err != nil {
+		return city, fmt.Errorf("longitude must be a number")
+	}
+	if city.ElevationM, err = optionalNumber(field("elevation_m"), strconv.Atoi); err != nil {
+		return city, fmt.Errorf("elevation_m must be an integer")
+	}
+	if city.Population, err = optionalNumber(field("population"), func(s string) (int64, error) { return strconv.ParseInt(s, 10, 64) }); err != nil {
+		return city, fmt.Errorf("population must be an integer")
+	}
+	return city, nil
+}
+
+// An empty csv field is null.
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func optionalNumber[T any](s string, parse func(string) (T, error)) (*T, error) {
+	if s == "" {
+		return nil, nil
+	}
+	n, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func parseTimes(created string, updated string) (time.Time, time.Time, error) {
+	var createdAt, updatedAt time.Time
+	var err error
+	if created != "" {
+		if createdAt, err = time.Parse(time.RFC3339Nano, created); err != nil {
+			return createdAt, updatedAt, fmt.Errorf("created_at must be an RFC 3339 timestamp")
+		}
+	}
+	if updated != "" {
+		if updatedAt, err = time.Parse(time.RFC3339Nano, updated); err != nil {
+			return createdAt, updatedAt, fmt.Errorf("updated_at must be an RFC 3339 timestamp")
+		}
+	}
+	return createdAt, updatedAt, nil
+}
+
+// Store upserts the dataset by id, parents first, and moves the id
+// sequences past the imported ids. It should be run in a transaction.
+func Store(ctx context.Context, db DB, ds Dataset) error {
+	// The boundaries are checked like the API checks them, and before any
+	// write, since an invalid boundary breaks the GeoJSON of its country.
+	for i, c := range ds.Countries {
+		if c.hasBoundary() {
+			if _, _, err := geo.ParseBoundary(c.Boundary); err != nil {
+				return fmt.Errorf("country row %d (id %d): %w", i+1, c.ID, err)
+			}
+		}
+	}
+
+	for _, c := range ds.Continents {
+		_, err := db.Exec(ctx, `INSERT INTO continents (id, name, created_at, updated_at)
+			VALUES ($1, $2, COALESCE($3, now()), COALESCE($4, now()))
+			ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at`,
+			c.ID, c.Name, optionalTime(c.CreatedAt), optionalTime(c.UpdatedAt))
+		if err != nil {
+			return fmt.Errorf("continent %d: %w", c.ID, err)
+		}
+	}
+
+	// The capitals are set after the cities exist.
+	for _, c := range ds.Countries {
+		_, err := db.Exec(ctx, `INSERT INTO countries (id, name, continent_id, iso_alpha2, iso_alpha3, iso_numeric, official_name,
+				capital_city_id, population, area_km2, calling_code, tld, created_at, updated_at, boundary)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NULL, $8, $9, $10, $11, COALESCE($12, now()), COALESCE($13, now()), $14)
+			ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, continent_id = EXCLUDED.continent_id, iso_alpha2 = EXCLUDED.iso_alpha2,
+				iso_alpha3 = EXCLUDED.iso_alpha3, iso_numeric = EXCLUDED.iso_numeric, official_name = EXCLUDED.official_name,
+				capital_city_id = NULL, population = EXCLUDED.population, area_km2 = EXCLUDED.area_km2, calling_code = EXCLUDED.calling_code,
+				tld = EXCLUDED.tld, created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at, boundary = EXCLUDED.boundary`,
+			c.ID, c.Name, c.ContinentID, c.ISOAlpha2, c.ISOAlpha3, c.ISONumeric, c.OfficialName,
+			c.Population, c.AreaKm2, c.CallingCode, c.TLD, optionalTime(c.CreatedAt), optionalTime(c.UpdatedAt), c.boundary())
+		if err != nil {
+			return fmt.Errorf("country %d: %w", c.ID, err)
+		}
+	}
+
+	for _, c := range ds.Cities {
+		_, err := db.Exec(ctx, `INSERT INTO cities (id, name, country_id, latitude, longitude, elevation_m, population, time_zone, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9, now()), COALESCE($10, now()))
+			ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, country_id = EXCLUDED.country_id, latitude = EXCLUDED.latitude,
+				longitude = EXCLUDED.longitude, elevation_m = EXCLUDED.elevation_m, population = EXCLUDED.population,
+				time_zone = EXCLUDED.time_zone, created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at`,
+			c.ID, c.Name, c.CountryID, c.Latitude, c.Longitude, c.ElevationM, c.Population, c.TimeZone,
+			optionalTime(c.CreatedAt), optionalTime(c.UpdatedAt))
+		if err != nil {
+			return fmt.Errorf("city %d: %w", c.ID, err)
+		}
+	}
+
+	for _, c := range ds.Countries {
+		if c.CapitalCityID == nil {
+			continue
+		}
+		_, err := db.Exec(ctx, "UPDATE countries SET capital_city_id = $1 WHERE id = $2", c.CapitalCityID, c.ID)
+		if err != nil {
+			return fmt.Errorf("country %d capital: %w", c.ID, err)
+		}
+	}
+
+	for _, table := range []string{"continents", "countries", "cities"} {
+		_, err := db.Exec(ctx, "SELECT setval(pg_get_serial_sequence('"+table+"', 'id'), COALESCE((SELECT MAX(id) FROM "+table+"), 0) + 1, false)")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
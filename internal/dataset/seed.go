@@ -0,0 +1,124 @@
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Seed is a nested description of continents, countries and cities which
+// is inserted without ids. Seeding again skips the existing names.
+type Seed struct {
+	Continents []SeedContinent `json:"continents"`
+}
+
+type SeedContinent struct {
+	Name      string        `json:"name"`
+	Countries []SeedCountry `json:"countries"`
+}
+
+type SeedCountry struct {
+	Name   string     `json:"name"`
+	Cities []SeedCity `json:"cities"`
+}
+
+type SeedCity struct {
+	Name string `json:"name"`
+}
+
+type SeedResult struct {
+	Continents int
+	Countries  int
+	Cities     int
+}
+
+func ReadSeed(r io.Reader) (Seed, error) {
+	var seed Seed
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&seed); err != nil {
+		return seed, fmt.Errorf("invalid seed file: %w", err)
+	}
+
+	for _, continent := range seed.Continents {
+		if strings.TrimSpace(continent.Name) == "" {
+			return seed, fmt.Errorf("invalid seed file: continent without a name")
+		}
+		for _, country := range continent.Countries {
+			if strings.TrimSpace(country.Name) == "" {
+				return seed, fmt.Errorf("invalid seed file: country without a name in %s", continent.Name)
+			}
+			for _, city := range country.Cities {
+				if strings.TrimSpace(city.Name) == "" {
+					return seed, fmt.Errorf("invalid seed file: city without a name in %s", country.Name)
+				}
+			}
+		}
+	}
+	return seed, nil
+}
+
+// ApplySeed inserts the seed and returns how many rows were created. It
+// should be run in a transaction.
+func ApplySeed(ctx context.Context, db DB, seed Seed) (SeedResult, error) {
+	var result SeedResult
+
+	for _, continent := range seed.Continents {
+		continentID, created, err := findOrCreate(ctx, db,
+			"SELECT id FROM continents WHERE name=$1",
+			"INSERT INTO continents (name) VALUES ($1) RETURNING id",
+			continent.Name)
+		if err != nil {
+			return result, fmt.Errorf("continent %s: %w", continent.Name, err)
+		}
+		if created {
+			result.Continents++
+		}
+
+		for _, country := range continent.Countries {
+			countryID, created, err := findOrCreate(ctx, db,
+				"SELECT id FROM countries WHERE name=$1 AND continent_id=$2",
+				"INSERT INTO countries (name, continent_id) VALUES ($1, $2) RETURNING id",
+				country.Name, continentID)
+			if err != nil {
+				return result, fmt.Errorf("country %s: %w", country.Name, err)
+			}
+			if created {
+				result.Countries++
+			}
+
+			for _, city := range country.Cities {
+				_, created, err := findOrCreate(ctx, db,
+					"SELECT id FROM cities WHERE name=$1 AND country_id=$2",
+					"INSERT INTO cities (name, country_id) VALUES ($1, $2) RETURNING id",
+					city.Name, countryID)
+				if err != nil {
+					return result, fmt.Errorf("city %s: %w", city.Name, err)
+				}
+				if created {
+					result.Cities++
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func findOrCreate(ctx context.Context, db DB, selectSQL string, insertSQL string, args ...any) (int, bool, error) {
+	var id int
+	err := db.QueryRow(ctx, selectSQL, args...).Scan(&id)
+	if err == nil {
+		return id, false, nil
+	}
+	if err != pgx.ErrNoRows {
+		return 0, false, err
+	}
+
+	err = db.QueryRow(ctx, insertSQL, args...).Scan(&id)
+	return id, err == nil, err
+}
@@ -0,0 +1,90 @@
+package geo
+
+import "math"
+
+// EarthRadiusKm is the mean radius of the Earth.
+const EarthRadiusKm = 6371.0088
+
+const kmPerMile = 1.609344
+
+type Point struct {
+	Lat float64
+	Lon float64
+}
+
+// Box is a range of latitudes and longitudes. The longitudes do not wrap,
+// so a box which crosses the antimeridian is split in two.
+type Box struct {
+	MinLat float64
+	MaxLat float64
+	MinLon float64
+	MaxLon float64
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+// DistanceKm is the great-circle distance between a and b with the
+// haversine formula.
+func DistanceKm(a, b Point) float64 {
+	dLat := radians(b.Lat - a.Lat)
+	dLon := radians(b.Lon - a.Lon)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(radians(a.Lat))*math.Cos(radians(b.Lat))*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func KmToMiles(km float64) float64 {
+	return km / kmPerMile
+}
+
+// InitialBearing is the direction from a to b at a, in degrees clockwise
+// from north between 0 and 360.
+func InitialBearing(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLon := radians(b.Lon - a.Lon)
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(degrees(math.Atan2(y, x))+360, 360)
+}
+
+// BoundingBoxes returns the boxes which contain every point within
+// radiusKm of p. The boxes are larger than the circle, so the distance
+// still has to be checked, but they can be searched with an index.
+func BoundingBoxes(p Point, radiusKm float64) []Box {
+	angle := radiusKm / EarthRadiusKm
+	minLat := p.Lat - degrees(angle)
+	maxLat := p.Lat + degrees(angle)
+
+	// Near a pole the circle covers every longitude.
+	if angle >= math.Pi || minLat <= -90 || maxLat >= 90 {
+		return []Box{{MinLat: math.Max(minLat, -90), MaxLat: math.Min(maxLat, 90), MinLon: -180, MaxLon: 180}}
+	}
+
+	dLon := degrees(math.Asin(math.Sin(angle) / math.Cos(radians(p.Lat))))
+	minLon := p.Lon - dLon
+	maxLon := p.Lon + dLon
+	switch {
+	case minLon < -180:
+		return []Box{
+			{MinLat: minLat, MaxLat: maxLat, MinLon: minLon + 360, MaxLon: 180},
+			{MinLat: minLat, MaxLat: maxLat, MinLon: -180, MaxLon: maxLon},
+		}
+	case maxLon > 180:
+		return []Box{
+			{MinLat: minLat, MaxLat: maxLat, MinLon: minLon, MaxLon: 180},
+			{MinLat: minLat, MaxLat: maxLat, MinLon: -180, MaxLon: maxLon - 360},
+		}
+	default:
+		return []Box{{MinLat: minLat, MaxLat: maxLat, MinLon: minLon, MaxLon: maxLon}}
+	}
+}
+
+// Contains reports whether p is in the box.
+func (b Box) Contains(p Point) bool {
+	return p.Lat >= b.MinLat && p.Lat <= b.MaxLat && p.Lon >= b.MinLon && p.Lon <= b.MaxLon
+}
@@ -0,0 +1,137 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+var (
+	helsinki = Point{Lat: 60.1699, Lon: 24.9384}
+	paris    = Point{Lat: 48.8566, Lon: 2.3522}
+	suva     = Point{Lat: -18.1416, Lon: 178.4419}
+	apia     = Point{Lat: -13.8507, Lon: -171.7514}
+)
+
+func TestDistanceKm(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Point
+		km   float64
+	}{
+		{"same point", paris, paris, 0},
+		{"Helsinki to Paris", helsinki, paris, 1909},
+		{"across the antimeridian", suva, apia, 1151},
+		{"antipodes", Point{Lat: 0, Lon: 0}, Point{Lat: 0, Lon: 180}, math.Pi * EarthRadiusKm},
+	}
+
+	for _, tt := range tests {
+		if km := DistanceKm(tt.a, tt.b); math.Abs(km-tt.km) > 1 {
+			t.Errorf("%s: expected %.0f km, but got %.1f km", tt.name, tt.km, km)
+		}
+	}
+}
+
+func TestInitialBearing(t *testing.T) {
+	tests := []struct {
+		a, b    Point
+		bearing float64
+	}{
+		{Point{Lat: 0, Lon: 0}, Point{Lat: 10, Lon: 0}, 0},
+		{Point{Lat: 0, Lon: 0}, Point{Lat: 0, Lon: 10}, 90},
+		{Point{Lat: 10, Lon: 0}, Point{Lat: 0, Lon: 0}, 180},
+		{Point{Lat: 0, Lon: 10}, Point{Lat: 0, Lon: 0}, 270},
+		{helsinki, paris, 238.9},
+	}
+
+	for _, tt := range tests {
+		if bearing := InitialBearing(tt.a, tt.b); math.Abs(bearing-tt.bearing) > 0.1 {
+			t.Errorf("Expected bearing %.1f from %v to %v, but got %.1f", tt.bearing, tt.a, tt.b, bearing)
+		}
+	}
+}
+
+func TestBoundingBoxes(t *testing.T) {
+	tests := []struct {
+		name   string
+		center Point
+		km     float64
+		boxes  int
+	}{
+		{"Paris", paris, 500, 1},
+		{"across the antimeridian", suva, 1500, 2},
+		{"near the pole", Point{Lat: 89, Lon: 0}, 500, 1},
+		{"whole earth", paris, 25000, 1},
+	}
+
+	for _, tt := range tests {
+		boxes := BoundingBoxes(tt.center, tt.km)
+		if len(boxes) != tt.boxes {
+			t.Errorf("%s: expected %d boxes, but got %v", tt.name, tt.boxes, boxes)
+		}
+
+		// Every point on the circle is in a box.
+		for bearing := 0.0; bearing < 360; bearing += 5 {
+			p := destination(tt.center, bearing, math.Min(tt.km, math.Pi*EarthRadiusKm)*0.999)
+			contained := false
+			for _, box := range boxes {
+				contained = contained || box.Contains(p)
+			}
+			if !contained {
+				t.Errorf("%s: expected %v at bearing %.0f to be in %v", tt.name, p, bearing, boxes)
+			}
+		}
+	}
+}
+
+func destination(p Point, bearing float64, km float64) Point {
+	angle := km / EarthRadiusKm
+	lat1, lon1, theta := radians(p.Lat), radians(p.Lon), radians(bearing)
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(angle) + math.Cos(lat1)*math.Sin(angle)*math.Cos(theta))
+	lon2 := lon1 + math.Atan2(math.Sin(theta)*math.Sin(angle)*math.Cos(lat1), math.Cos(angle)-math.Sin(lat1)*math.Sin(lat2))
+	return Point{Lat: degrees(lat2), Lon: math.Mod(degrees(lon2)+540, 360) - 180}
+}
+
+func TestPolygonValidate(t *testing.T) {
+	square := Polygon{{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}}
+	if err := square.Validate(); err != nil {
+		t.Errorf("Expected a valid polygon, but got %v", err)
+	}
+
+	tests := map[string]Polygon{
+		"no rings":     {},
+		"too short":    {{{0, 0}, {1, 0}, {0, 0}}},
+		"not closed":   {{{0, 0}, {1, 0}, {1, 1}, {0, 1}}},
+		"out of range": {{{0, 0}, {181, 0}, {1, 1}, {0, 0}}},
+		"one number":   {{{0, 0}, {1}, {1, 1}, {0, 0}}},
+	}
+	for name, polygon := range tests {
+		if err := polygon.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPolygonSimplify(t *testing.T) {
+	// A square with a point just off each side, and a tiny hole.
+	polygon := Polygon{
+		{{0, 0}, {5, 0.01}, {10, 0}, {10.01, 5}, {10, 10}, {5, 9.99}, {0, 10}, {0.01, 5}, {0, 0}},
+		{{4, 4}, {4.001, 4}, {4.001, 4.001}, {4, 4}},
+	}
+
+	simplified := polygon.Simplify(0.1)
+	want := Polygon{{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}}
+	if fmt.Sprint(simplified) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, but got %v", want, simplified)
+	}
+	if err := simplified.Validate(); err != nil {
+		t.Errorf("Expected the simplified polygon to be valid, but got %v", err)
+	}
+
+	if kept := polygon.Simplify(0.001); len(kept[0]) != len(polygon[0]) {
+		t.Errorf("Expected a small tolerance to keep the positions, but got %v", kept)
+	}
+	if kept := polygon.Simplify(100); len(kept) != 1 || len(kept[0]) != len(polygon[0]) {
+		t.Errorf("Expected the collapsing exterior ring to be kept, but got %v", kept)
+	}
+}
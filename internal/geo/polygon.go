@@ -0,0 +1,173 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Position is a GeoJSON position: longitude, latitude and an optional
+// altitude.
+type Position []float64
+
+// Polygon is a list of closed linear rings, the exterior ring first and the
+// holes after it.
+type Polygon [][]Position
+
+type MultiPolygon []Polygon
+
+// Validate checks that the rings are closed, have at least four positions,
+// and that the positions are coordinates.
+func (p Polygon) Validate() error {
+	if len(p) == 0 {
+		return fmt.Errorf("polygon must have an exterior ring")
+	}
+	for i, ring := range p {
+		if len(ring) < 4 {
+			return fmt.Errorf("ring %d must have at least 4 positions", i)
+		}
+		for j, position := range ring {
+			if len(position) < 2 || len(position) > 3 {
+				return fmt.Errorf("ring %d position %d must have a longitude and a latitude", i, j)
+			}
+			if position[0] < -180 || position[0] > 180 || position[1] < -90 || position[1] > 90 {
+				return fmt.Errorf("ring %d position %d is out of range", i, j)
+			}
+		}
+		if !slices.Equal(ring[0], ring[len(ring)-1]) {
+			return fmt.Errorf("ring %d must end at its first position", i)
+		}
+	}
+	return nil
+}
+
+func (m MultiPolygon) Validate() error {
+	if len(m) == 0 {
+		return fmt.Errorf("multipolygon must have a polygon")
+	}
+	for i, p := range m {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("polygon %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Simplify removes the positions which are closer than tolerance degrees
+// to the simplified outline, with the Douglas-Peucker algorithm. A hole
+// which would collapse is dropped, and an exterior ring which would
+// collapse is kept as it is.
+func (p Polygon) Simplify(tolerance float64) Polygon {
+	if tolerance <= 0 {
+		return p
+	}
+	simplified := make(Polygon, 0, len(p))
+	for i, ring := range p {
+		s := simplifyRing(ring, tolerance)
+		switch {
+		case len(s) >= 4:
+			simplified = append(simplified, s)
+		case i == 0:
+			simplified = append(simplified, ring)
+		}
+	}
+	return simplified
+}
+
+func (m MultiPolygon) Simplify(tolerance float64) MultiPolygon {
+	simplified := make(MultiPolygon, len(m))
+	for i, p := range m {
+		simplified[i] = p.Simplify(tolerance)
+	}
+	return simplified
+}
+
+// simplifyRing keeps the first position, which is also the last, and
+// simplifies the ring in two halves split at the position farthest from it.
+func simplifyRing(ring []Position, tolerance float64) []Position {
+	farthest, maxDistance := 0, 0.0
+	for i := 1; i < len(ring)-1; i++ {
+		if d := planarDistance(ring[0], ring[i]); d > maxDistance {
+			farthest, maxDistance = i, d
+		}
+	}
+	if farthest == 0 {
+		return ring[:1]
+	}
+
+	first := douglasPeucker(ring[:farthest+1], tolerance)
+	second := douglasPeucker(ring[farthest:], tolerance)
+	return append(first, second[1:]...)
+}
+
+func douglasPeucker(line []Position, tolerance float64) []Position {
+	if len(line) < 3 {
+		return slices.Clone(line)
+	}
+
+	farthest, maxDistance := 0, 0.0
+	for i := 1; i < len(line)-1; i++ {
+		if d := segmentDistance(line[i], line[0], line[len(line)-1]); d > maxDistance {
+			farthest, maxDistance = i, d
+		}
+	}
+	if maxDistance <= tolerance {
+		return []Position{line[0], line[len(line)-1]}
+	}
+
+	first := douglasPeucker(line[:farthest+1], tolerance)
+	second := douglasPeucker(line[farthest:], tolerance)
+	return append(first, second[1:]...)
+}
+
+func planarDistance(a, b Position) float64 {
+	return math.Hypot(b[0]-a[0], b[1]-a[1])
+}
+
+// segmentDistance is the distance from p to the segment from a to b, in
+// degrees on the plane.
+func segmentDistance(p, a, b Position) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	if dx == 0 && dy == 0 {
+		return planarDistance(p, a)
+	}
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
+}
+
+// ParseBoundary decodes and validates a GeoJSON Polygon or MultiPolygon
+// geometry, and returns its type and its Polygon or MultiPolygon.
+func ParseBoundary(data []byte) (string, any, error) {
+	var raw struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return "", nil, fmt.Errorf("boundary is not valid JSON")
+	}
+
+	switch raw.Type {
+	case "Polygon":
+		var polygon Polygon
+		if err := json.Unmarshal(raw.Coordinates, &polygon); err != nil {
+			return "", nil, fmt.Errorf("boundary coordinates must be an array of rings")
+		}
+		if err := polygon.Validate(); err != nil {
+			return "", nil, fmt.Errorf("boundary is invalid: %w", err)
+		}
+		return raw.Type, polygon, nil
+	case "MultiPolygon":
+		var multiPolygon MultiPolygon
+		if err := json.Unmarshal(raw.Coordinates, &multiPolygon); err != nil {
+			return "", nil, fmt.Errorf("boundary coordinates must be an array of polygons")
+		}
+		if err := multiPolygon.Validate(); err != nil {
+			return "", nil, fmt.Errorf("boundary is invalid: %w", err)
+		}
+		return raw.Type, multiPolygon, nil
+	default:
+		return "", nil, fmt.Errorf("boundary must be a GeoJSON Polygon or MultiPolygon geometry")
+	}
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/api/v1/city/:id", func(c *gin.Context) { c.String(http.StatusOK, "Helsinki") })
+
+	for _, path := range []string{"/api/v1/city/1", "/api/v1/city/2", "/unknown"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if n := testutil.ToFloat64(requestsTotal.WithLabelValues("/api/v1/city/:id", "GET", "200")); n != 2 {
+		t.Errorf("Expected 2 requests for the route template, but got %v", n)
+	}
+	if n := testutil.ToFloat64(requestsTotal.WithLabelValues(unmatchedRoute, "GET", "404")); n != 1 {
+		t.Errorf("Expected 1 unmatched request, but got %v", n)
+	}
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, name := range []string{"http_request_duration_seconds_bucket", "http_response_size_bytes_sum", "go_goroutines"} {
+		if !strings.Contains(w.Body.String(), name) {
+			t.Errorf("Expected the metric %s to be exported", name)
+		}
+	}
+}
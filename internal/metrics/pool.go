@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolAcquiredConns = prometheus.NewDesc("pgxpool_acquired_conns", "Number of connections which are in use.", nil, nil)
+	poolIdleConns     = prometheus.NewDesc("pgxpool_idle_conns", "Number of idle connections.", nil, nil)
+	poolTotalConns    = prometheus.NewDesc("pgxpool_total_conns", "Number of open connections.", nil, nil)
+	poolMaxConns      = prometheus.NewDesc("pgxpool_max_conns", "Maximum size of the pool.", nil, nil)
+	poolAcquires      = prometheus.NewDesc("pgxpool_acquires_total", "Number of connections acquired from the pool.", nil, nil)
+	poolEmptyAcquires = prometheus.NewDesc("pgxpool_empty_acquires_total", "Number of acquires which waited for a connection because the pool was empty.", nil, nil)
+	poolCanceled      = prometheus.NewDesc("pgxpool_canceled_acquires_total", "Number of acquires which were canceled by the context.", nil, nil)
+	poolAcquireWait   = prometheus.NewDesc("pgxpool_acquire_duration_seconds_total", "Total time spent acquiring connections.", nil, nil)
+	poolEmptyWait     = prometheus.NewDesc("pgxpool_empty_acquire_wait_seconds_total", "Total time spent waiting for a connection because the pool was empty.", nil, nil)
+)
+
+// poolCollector reads pgxpool.Stat() on every scrape.
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (p *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquiredConns
+	ch <- poolIdleConns
+	ch <- poolTotalConns
+	ch <- poolMaxConns
+	ch <- poolAcquires
+	ch <- poolEmptyAcquires
+	ch <- poolCanceled
+	ch <- poolAcquireWait
+	ch <- poolEmptyWait
+}
+
+func (p *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := p.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceled, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireWait, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(poolEmptyWait, prometheus.CounterValue, stat.EmptyAcquireWaitTime().Seconds())
+}
@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatalf("Expected embedded migrations")
+	}
+	for i, m := range migrations {
+		if m.Up == "" || m.Down == "" {
+			t.Errorf("Expected migration %d_%s to have up and down files", m.Version, m.Name)
+		}
+		if i > 0 && migrations[i-1].Version >= m.Version {
+			t.Errorf("Expected migrations to be ordered by version, but %d is after %d", m.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"bad name": {
+			"sql/create_tables.sql": {Data: []byte("SELECT 1")},
+		},
+		"missing up": {
+			"sql/0001_tables.down.sql": {Data: []byte("SELECT 1")},
+		},
+		"two names": {
+			"sql/0001_tables.up.sql":  {Data: []byte("SELECT 1")},
+			"sql/0001_columns.up.sql": {Data: []byte("SELECT 1")},
+		},
+	}
+
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := load(fsys); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
+
+func TestOwnershipHint(t *testing.T) {
+	err := ownershipHint(&pgconn.PgError{Code: "42501", Message: "must be owner of table continents"})
+	if !strings.Contains(err.Error(), "init-db.sh") {
+		t.Errorf("Expected a hint to change the owner, but got '%v'", err)
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		t.Errorf("Expected the PostgreSQL error to be wrapped, but got %T", err)
+	}
+
+	other := &pgconn.PgError{Code: "42P07", Message: "relation already exists"}
+	if err := ownershipHint(other); err != other {
+		t.Errorf("Expected other errors to be unchanged, but got '%v'", err)
+	}
+}
@@ -0,0 +1,3 @@
+ALTER TABLE cities DROP COLUMN IF EXISTS created_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE countries DROP COLUMN IF EXISTS created_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE continents DROP COLUMN IF EXISTS created_at, DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,13 @@
+ALTER TABLE countries DROP CONSTRAINT IF EXISTS countries_capital_city_id_fkey;
+ALTER TABLE cities DROP CONSTRAINT IF EXISTS cities_id_country_id_key;
+
+ALTER TABLE countries
+    DROP COLUMN IF EXISTS iso_alpha2,
+    DROP COLUMN IF EXISTS iso_alpha3,
+    DROP COLUMN IF EXISTS iso_numeric,
+    DROP COLUMN IF EXISTS official_name,
+    DROP COLUMN IF EXISTS capital_city_id,
+    DROP COLUMN IF EXISTS population,
+    DROP COLUMN IF EXISTS area_km2,
+    DROP COLUMN IF EXISTS calling_code,
+    DROP COLUMN IF EXISTS tld;
@@ -0,0 +1,19 @@
+ALTER TABLE countries
+    ADD COLUMN IF NOT EXISTS iso_alpha2 VARCHAR(2) UNIQUE CHECK (iso_alpha2 ~ '^[A-Z]{2}$'),
+    ADD COLUMN IF NOT EXISTS iso_alpha3 VARCHAR(3) UNIQUE CHECK (iso_alpha3 ~ '^[A-Z]{3}$'),
+    ADD COLUMN IF NOT EXISTS iso_numeric VARCHAR(3) UNIQUE CHECK (iso_numeric ~ '^[0-9]{3}$'),
+    ADD COLUMN IF NOT EXISTS official_name VARCHAR(200),
+    ADD COLUMN IF NOT EXISTS capital_city_id INT,
+    ADD COLUMN IF NOT EXISTS population BIGINT CHECK (population >= 0),
+    ADD COLUMN IF NOT EXISTS area_km2 DOUBLE PRECISION CHECK (area_km2 > 0),
+    ADD COLUMN IF NOT EXISTS calling_code VARCHAR(10) CHECK (calling_code ~ '^\+[0-9]{1,3}(-[0-9]{1,4})?$'),
+    ADD COLUMN IF NOT EXISTS tld VARCHAR(64) CHECK (tld ~ '^\.[a-z]{2,63}$');
+
+-- The capital must be a city of the country, and deleting it clears only
+-- the capital. Moving it to another country fails, because ON UPDATE
+-- cannot clear only the capital.
+ALTER TABLE cities ADD CONSTRAINT cities_id_country_id_key UNIQUE (id, country_id);
+
+ALTER TABLE countries
+    ADD CONSTRAINT countries_capital_city_id_fkey FOREIGN KEY (capital_city_id, id)
+    REFERENCES cities (id, country_id) ON DELETE SET NULL (capital_city_id);
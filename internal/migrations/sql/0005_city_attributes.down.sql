@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS cities_population_idx;
+
+ALTER TABLE cities
+    DROP CONSTRAINT IF EXISTS cities_coordinates_check,
+    DROP COLUMN IF EXISTS latitude,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS elevation_m,
+    DROP COLUMN IF EXISTS population,
+    DROP COLUMN IF EXISTS time_zone;
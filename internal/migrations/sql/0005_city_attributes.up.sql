@@ -0,0 +1,10 @@
+ALTER TABLE cities
+    ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION CHECK (latitude BETWEEN -90 AND 90),
+    ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION CHECK (longitude BETWEEN -180 AND 180),
+    ADD COLUMN IF NOT EXISTS elevation_m INT,
+    ADD COLUMN IF NOT EXISTS population BIGINT CHECK (population >= 0),
+    ADD COLUMN IF NOT EXISTS time_zone TEXT,
+    ADD CONSTRAINT cities_coordinates_check CHECK ((latitude IS NULL) = (longitude IS NULL));
+
+-- The same expression as the population sort of the list endpoints.
+CREATE INDEX IF NOT EXISTS cities_population_idx ON cities (COALESCE(population, -1), id);
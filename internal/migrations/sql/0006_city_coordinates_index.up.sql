@@ -0,0 +1,3 @@
+-- The nearby search filters the cities by a bounding box of coordinates
+-- before it computes the distances.
+CREATE INDEX IF NOT EXISTS cities_latitude_longitude_idx ON cities (latitude, longitude);
@@ -0,0 +1,4 @@
+-- The boundary is a GeoJSON Polygon or MultiPolygon geometry, which the API
+-- validates before it is stored.
+ALTER TABLE countries
+    ADD COLUMN IF NOT EXISTS boundary JSONB CHECK (boundary->>'type' IN ('Polygon', 'MultiPolygon'));
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket which holds up to Burst tokens and refills Rate
+// tokens per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the request would be allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Store keeps the buckets. The memory store is local to the process, and a
+// shared store such as Redis can implement the interface for replicas.
+type Store interface {
+	Take(ctx context.Context, key string, cost int, limit Limit) (Result, error)
+	// Peek tells whether Take would allow the cost, without taking the
+	// tokens, so Remaining is what the bucket holds now.
+	Peek(ctx context.Context, key string, cost int, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// sweepInterval is how often the full buckets are removed from the memory
+// store, since they are the same as new buckets.
+const sweepInterval = time.Minute
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, cost int, limit Limit) (Result, error) {
+	return s.take(key, cost, limit, true), nil
+}
+
+func (s *MemoryStore) Peek(ctx context.Context, key string, cost int, limit Limit) (Result, error) {
+	return s.take(key, cost, limit, false), nil
+}
+
+func (s *MemoryStore) take(key string, cost int, limit Limit, commit bool) Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	burst := float64(limit.Burst)
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now, limit)
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	// A request which costs more than the burst would never be allowed.
+	need := math.Min(float64(cost), burst)
+	result := Result{}
+	tokens := b.tokens
+	if tokens >= need {
+		tokens -= need
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((need - tokens) / limit.Rate)
+	}
+	if commit {
+		b.tokens = tokens
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((burst - b.tokens) / limit.Rate)
+	return result
+}
+
+func (s *MemoryStore) sweep(now time.Time, limit Limit) {
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*limit.Rate >= float64(limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
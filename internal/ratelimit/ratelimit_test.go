@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 3}
+
+	for i := range 3 {
+		result, _ := store.Take(context.Background(), "client", 1, limit)
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("Expected request %d to be allowed, but got %+v", i, result)
+		}
+	}
+
+	result, _ := store.Take(context.Background(), "client", 1, limit)
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Errorf("Expected the empty bucket to deny for a second, but got %+v", result)
+	}
+
+	if result, _ := store.Take(context.Background(), "other", 2, limit); !result.Allowed || result.Remaining != 1 {
+		t.Errorf("Expected another key to have its own bucket, but got %+v", result)
+	}
+
+	now = now.Add(2 * time.Second)
+	if result, _ := store.Take(context.Background(), "client", 2, limit); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected the bucket to refill, but got %+v", result)
+	}
+
+	now = now.Add(time.Hour)
+	store.Take(context.Background(), "client", 1, limit)
+	if len(store.buckets) != 1 {
+		t.Errorf("Expected the idle buckets to be swept, but there are %d", len(store.buckets))
+	}
+}
+
+func TestMemoryStorePeek(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+
+	for range 2 {
+		if result, _ := store.Peek(context.Background(), "client", 2, limit); !result.Allowed || result.Remaining != 2 {
+			t.Fatalf("Expected the peek to allow without taking, but got %+v", result)
+		}
+	}
+
+	store.Take(context.Background(), "client", 2, limit)
+	if result, _ := store.Peek(context.Background(), "client", 1, limit); result.Allowed || result.RetryAfter != time.Second {
+		t.Errorf("Expected the peek of the empty bucket to deny, but got %+v", result)
+	}
+}
@@ -2,29 +2,70 @@ package setup
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"example.com/api/internal/auth"
+	"example.com/api/internal/ratelimit"
+	"example.com/api/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-type ConfigItem struct {
-	Name  string
-	Value string
-}
-
 type Config struct {
-	PgHostname ConfigItem
-	PgPort     ConfigItem
-	PgDatabase ConfigItem
-	PgUsername ConfigItem
-	PgPassword ConfigItem
-	PgPool     DBPool
-	GinEngine  *gin.Engine
+	PgHostname            ConfigItem
+	PgPort                ConfigItem
+	PgDatabase            ConfigItem
+	PgUsername            ConfigItem
+	PgPassword            ConfigItem
+	PgPasswordFile        ConfigItem
+	PgPoolMaxConns        ConfigItem
+	PgPoolMinConns        ConfigItem
+	PgPoolMaxConnLifetime ConfigItem
+	DbMigrations          ConfigItem
+	DbConnectTimeout      ConfigItem
+	DbConnectBackoff      ConfigItem
+	DbConnectMaxBackoff   ConfigItem
+	DbStartDegraded       ConfigItem
+	DbStatementTimeout    ConfigItem
+	DbRouteTimeouts       ConfigItem
+	ServerAddress         ConfigItem
+	ServerReadTimeout     ConfigItem
+	ServerWriteTimeout    ConfigItem
+	ServerIdleTimeout     ConfigItem
+	ShutdownTimeout       ConfigItem
+	ShutdownDrainDelay    ConfigItem
+	TrustedProxies        ConfigItem
+	AdminAddress          ConfigItem
+	LogLevel              ConfigItem
+	LogFormat             ConfigItem
+	TracingExporter       ConfigItem
+	TracingOtlpEndpoint   ConfigItem
+	TracingServiceName    ConfigItem
+	CorsAllowedOrigins    ConfigItem
+	AuthMode              ConfigItem
+	AuthJwtIssuer         ConfigItem
+	AuthJwtAudience       ConfigItem
+	AuthJwtJwksURL        ConfigItem
+	AuthJwtJwksRefresh    ConfigItem
+	AuthRoleScopes        ConfigItem
+	RateLimitPerMinute    ConfigItem
+	RateLimitBurst        ConfigItem
+	RateLimitRouteCosts   ConfigItem
+	DistanceMatrixMax     ConfigItem
+	PgPool                DBPool
+	Health                *Health
+	GinEngine             *gin.Engine
 }
 
-var cfg = Config{}
+var cfg = Config{Health: &Health{}}
 
 type PgxPoolWrapper struct {
 	Pool *pgxpool.Pool
@@ -46,17 +87,40 @@ func GetConfig() *Config {
 	return &cfg
 }
 
+// InitializeConfig loads the configuration, connects to the database and
+// runs the migrations according to DB_MIGRATIONS.
 func InitializeConfig() error {
+	loadErr := LoadConfig()
+	if loadErr != nil {
+		return loadErr
+	}
+
+	migrateErr := migrateDatabase(GetConfig())
+	if migrateErr != nil {
+		return migrateErr
+	}
+
+	return nil
+}
+
+// InitializeServerConfig is InitializeConfig for the server. With
+// DB_START_DEGRADED, it returns once the configuration is loaded, and the
+// database is connected and migrated in the background while the readiness
+// reports that the server is starting.
+func InitializeServerConfig() error {
 	cfg := GetConfig()
-	cfg.PgHostname = ConfigItem{}
-	cfg.PgPort = ConfigItem{}
-	cfg.PgDatabase = ConfigItem{}
-	cfg.PgUsername = ConfigItem{}
-	cfg.PgPassword = ConfigItem{}
 
-	getEnvsErr := getEnvs(cfg)
-	if getEnvsErr != nil {
-		return getEnvsErr
+	loadItemsErr := loadItems(cfg)
+	if loadItemsErr != nil {
+		return loadItemsErr
+	}
+
+	if !cfg.DbStartDegraded.Bool() {
+		connectErr := connectDatabase(cfg)
+		if connectErr != nil {
+			return connectErr
+		}
+		return migrateDatabase(cfg)
 	}
 
 	initDbErr := initializeDatabase(cfg)
@@ -64,5 +128,307 @@ func InitializeConfig() error {
 		return initDbErr
 	}
 
+	cfg.Health.SetStarting(true)
+	go func() {
+		retryErr := retry(context.Background(), cfg, 0, func(ctx context.Context) error {
+			pingErr := pingDatabase(ctx, cfg)
+			if pingErr != nil {
+				return pingErr
+			}
+			return migrateDatabase(cfg)
+		})
+		if retryErr == nil {
+			cfg.Health.SetStarting(false)
+		}
+	}()
+
+	return nil
+}
+
+// LoadConfig loads the configuration and connects to the database without
+// touching the schema.
+func LoadConfig() error {
+	cfg := GetConfig()
+
+	loadItemsErr := loadItems(cfg)
+	if loadItemsErr != nil {
+		return loadItemsErr
+	}
+
+	connectErr := connectDatabase(cfg)
+	if connectErr != nil {
+		return connectErr
+	}
+
+	return nil
+}
+
+func defineItems(cfg *Config) {
+	cfg.PgHostname = ConfigItem{Name: "PG_HOSTNAME", Key: "pg.hostname", Required: true}
+	cfg.PgPort = ConfigItem{Name: "PG_PORT", Key: "pg.port", Default: "5432", Kind: KindInt}
+	cfg.PgDatabase = ConfigItem{Name: "PG_DATABASE", Key: "pg.database", Required: true}
+	cfg.PgUsername = ConfigItem{Name: "PG_USERNAME", Key: "pg.username", Required: true}
+	cfg.PgPassword = ConfigItem{Name: "PG_PASSWORD", Key: "pg.password", Secret: true}
+	cfg.PgPasswordFile = ConfigItem{Name: "PG_PASSWORD_FILE", Key: "pg.password_file"}
+	cfg.PgPoolMaxConns = ConfigItem{Name: "PG_POOL_MAX_CONNS", Key: "pg.pool.max_conns", Default: "10", Kind: KindInt}
+	cfg.PgPoolMinConns = ConfigItem{Name: "PG_POOL_MIN_CONNS", Key: "pg.pool.min_conns", Default: "0", Kind: KindInt}
+	cfg.PgPoolMaxConnLifetime = ConfigItem{Name: "PG_POOL_MAX_CONN_LIFETIME", Key: "pg.pool.max_conn_lifetime", Default: "1h", Kind: KindDuration}
+	cfg.DbMigrations = ConfigItem{Name: "DB_MIGRATIONS", Key: "db.migrations", Default: MigrationsUp, Allowed: []string{MigrationsUp, MigrationsCheck, MigrationsOff}}
+	cfg.DbConnectTimeout = ConfigItem{Name: "DB_CONNECT_TIMEOUT", Key: "db.connect_timeout", Default: "30s", Kind: KindDuration}
+	cfg.DbConnectBackoff = ConfigItem{Name: "DB_CONNECT_BACKOFF", Key: "db.connect_backoff", Default: "500ms", Kind: KindDuration}
+	cfg.DbConnectMaxBackoff = ConfigItem{Name: "DB_CONNECT_MAX_BACKOFF", Key: "db.connect_max_backoff", Default: "10s", Kind: KindDuration}
+	cfg.DbStartDegraded = ConfigItem{Name: "DB_START_DEGRADED", Key: "db.start_degraded", Default: "false", Kind: KindBool}
+	cfg.DbStatementTimeout = ConfigItem{Name: "DB_STATEMENT_TIMEOUT", Key: "db.statement_timeout", Default: "5s", Kind: KindDuration}
+	cfg.DbRouteTimeouts = ConfigItem{Name: "DB_ROUTE_STATEMENT_TIMEOUTS", Key: "db.route_statement_timeouts", Kind: KindList}
+	cfg.ServerAddress = ConfigItem{Name: "SERVER_ADDRESS", Key: "server.address", Default: "0.0.0.0:8080"}
+	cfg.ServerReadTimeout = ConfigItem{Name: "SERVER_READ_TIMEOUT", Key: "server.read_timeout", Default: "15s", Kind: KindDuration}
+	cfg.ServerWriteTimeout = ConfigItem{Name: "SERVER_WRITE_TIMEOUT", Key: "server.write_timeout", Default: "30s", Kind: KindDuration}
+	cfg.ServerIdleTimeout = ConfigItem{Name: "SERVER_IDLE_TIMEOUT", Key: "server.idle_timeout", Default: "60s", Kind: KindDuration}
+	cfg.ShutdownTimeout = ConfigItem{Name: "SERVER_SHUTDOWN_TIMEOUT", Key: "server.shutdown_timeout", Default: "5s", Kind: KindDuration}
+	cfg.ShutdownDrainDelay = ConfigItem{Name: "SERVER_SHUTDOWN_DRAIN_DELAY", Key: "server.shutdown_drain_delay", Default: "5s", Kind: KindDuration}
+	cfg.TrustedProxies = ConfigItem{Name: "SERVER_TRUSTED_PROXIES", Key: "server.trusted_proxies", Kind: KindList}
+	cfg.AdminAddress = ConfigItem{Name: "ADMIN_ADDRESS", Key: "admin.address", Default: "0.0.0.0:9090"}
+	cfg.LogLevel = ConfigItem{Name: "LOG_LEVEL", Key: "log.level", Default: "info", Allowed: []string{"debug", "info", "warn", "error"}}
+	cfg.LogFormat = ConfigItem{Name: "LOG_FORMAT", Key: "log.format", Default: LogFormatJSON, Allowed: []string{LogFormatJSON, LogFormatText}}
+	cfg.TracingExporter = ConfigItem{Name: "TRACING_EXPORTER", Key: "tracing.exporter", Default: tracing.ExporterNone, Allowed: []string{tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP}}
+	cfg.TracingOtlpEndpoint = ConfigItem{Name: "TRACING_OTLP_ENDPOINT", Key: "tracing.otlp_endpoint"}
+	cfg.TracingServiceName = ConfigItem{Name: "TRACING_SERVICE_NAME", Key: "tracing.service_name", Default: "api"}
+	cfg.CorsAllowedOrigins = ConfigItem{Name: "CORS_ALLOWED_ORIGINS", Key: "cors.allowed_origins", Kind: KindList}
+	cfg.AuthMode = ConfigItem{Name: "AUTH_MODE", Key: "auth.mode", Default: auth.ModeNone, Kind: KindList, Allowed: []string{auth.ModeNone, auth.ModeAPIKey, auth.ModeJWT}}
+	cfg.AuthJwtIssuer = ConfigItem{Name: "AUTH_JWT_ISSUER", Key: "auth.jwt.issuer"}
+	cfg.AuthJwtAudience = ConfigItem{Name: "AUTH_JWT_AUDIENCE", Key: "auth.jwt.audience"}
+	cfg.AuthJwtJwksURL = ConfigItem{Name: "AUTH_JWT_JWKS_URL", Key: "auth.jwt.jwks_url"}
+	cfg.AuthJwtJwksRefresh = ConfigItem{Name: "AUTH_JWT_JWKS_REFRESH", Key: "auth.jwt.jwks_refresh", Default: "15m", Kind: KindDuration}
+	cfg.AuthRoleScopes = ConfigItem{Name: "AUTH_ROLE_SCOPES", Key: "auth.role_scopes", Kind: KindList}
+	cfg.RateLimitPerMinute = ConfigItem{Name: "RATE_LIMIT_PER_MINUTE", Key: "rate_limit.per_minute", Default: "0", Kind: KindInt}
+	cfg.RateLimitBurst = ConfigItem{Name: "RATE_LIMIT_BURST", Key: "rate_limit.burst", Default: "0", Kind: KindInt}
+	cfg.RateLimitRouteCosts = ConfigItem{Name: "RATE_LIMIT_ROUTE_COSTS", Key: "rate_limit.route_costs", Kind: KindList}
+	cfg.DistanceMatrixMax = ConfigItem{Name: "DISTANCE_MATRIX_MAX_CITIES", Key: "distance.matrix_max_cities", Default: "50", Kind: KindInt}
+}
+
+func (c *Config) items() []*ConfigItem {
+	return []*ConfigItem{
+		&c.PgHostname,
+		&c.PgPort,
+		&c.PgDatabase,
+		&c.PgUsername,
+		&c.PgPassword,
+		&c.PgPasswordFile,
+		&c.PgPoolMaxConns,
+		&c.PgPoolMinConns,
+		&c.PgPoolMaxConnLifetime,
+		&c.DbMigrations,
+		&c.DbConnectTimeout,
+		&c.DbConnectBackoff,
+		&c.DbConnectMaxBackoff,
+		&c.DbStartDegraded,
+		&c.DbStatementTimeout,
+		&c.DbRouteTimeouts,
+		&c.ServerAddress,
+		&c.ServerReadTimeout,
+		&c.ServerWriteTimeout,
+		&c.ServerIdleTimeout,
+		&c.ShutdownTimeout,
+		&c.ShutdownDrainDelay,
+		&c.TrustedProxies,
+		&c.AdminAddress,
+		&c.LogLevel,
+		&c.LogFormat,
+		&c.TracingExporter,
+		&c.TracingOtlpEndpoint,
+		&c.TracingServiceName,
+		&c.CorsAllowedOrigins,
+		&c.AuthMode,
+		&c.AuthJwtIssuer,
+		&c.AuthJwtAudience,
+		&c.AuthJwtJwksURL,
+		&c.AuthJwtJwksRefresh,
+		&c.AuthRoleScopes,
+		&c.RateLimitPerMinute,
+		&c.RateLimitBurst,
+		&c.RateLimitRouteCosts,
+		&c.DistanceMatrixMax,
+	}
+}
+
+// loadItems applies the layers in order: defaults, the configuration file,
+// the environment variables and the command line flags. All invalid items
+// are reported in one error.
+func loadItems(cfg *Config) error {
+	defineItems(cfg)
+
+	for _, item := range cfg.items() {
+		item.set(item.Default, SourceDefault)
+	}
+
+	readFileErr := readConfigFile(cfg)
+	if readFileErr != nil {
+		return readFileErr
+	}
+
+	getEnvs(cfg)
+	getFlags(cfg)
+
+	validateErr := validate(cfg)
+	if validateErr != nil {
+		return validateErr
+	}
+
+	initializeLogger(cfg)
 	return nil
 }
+
+func validate(cfg *Config) error {
+	var errs []error
+	for _, item := range cfg.items() {
+		if err := item.parse(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	switch {
+	case cfg.PgPassword.Value == "" && cfg.PgPasswordFile.Value == "":
+		errs = append(errs, fmt.Errorf("%s (%s) or %s (%s) is required", cfg.PgPassword.Name, cfg.PgPassword.Key, cfg.PgPasswordFile.Name, cfg.PgPasswordFile.Key))
+	case cfg.PgPassword.Value != "" && cfg.PgPasswordFile.Value != "":
+		errs = append(errs, fmt.Errorf("only one of %s and %s can be set", cfg.PgPassword.Name, cfg.PgPasswordFile.Name))
+	case cfg.PgPasswordFile.Value != "":
+		if _, err := readSecretFile(cfg.PgPasswordFile.Value); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", cfg.PgPasswordFile.Name, cfg.PgPasswordFile.Key, err))
+		}
+	}
+
+	if cfg.DbConnectBackoff.parsed != nil && cfg.DbConnectBackoff.Duration() <= 0 {
+		errs = append(errs, fmt.Errorf("%s must be positive", cfg.DbConnectBackoff.Name))
+	}
+	if cfg.DbConnectMaxBackoff.parsed != nil && cfg.DbConnectMaxBackoff.Duration() < cfg.DbConnectBackoff.Duration() {
+		errs = append(errs, fmt.Errorf("%s must be at least %s", cfg.DbConnectMaxBackoff.Name, cfg.DbConnectBackoff.Name))
+	}
+
+	if _, err := parseRouteTimeouts(cfg.DbRouteTimeouts.List()); err != nil {
+		errs = append(errs, fmt.Errorf("%s (%s) %w", cfg.DbRouteTimeouts.Name, cfg.DbRouteTimeouts.Key, err))
+	}
+
+	for _, proxy := range cfg.TrustedProxies.List() {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("%s (%s) must be a list of addresses or CIDRs, got %q", cfg.TrustedProxies.Name, cfg.TrustedProxies.Key, proxy))
+		}
+	}
+
+	authModes := cfg.AuthMode.List()
+	if slices.Contains(authModes, auth.ModeNone) && len(authModes) > 1 {
+		errs = append(errs, fmt.Errorf("%s cannot combine %s with other modes", cfg.AuthMode.Name, auth.ModeNone))
+	}
+	if slices.Contains(authModes, auth.ModeJWT) && cfg.AuthJwtIssuer.Value == "" && cfg.AuthJwtJwksURL.Value == "" {
+		errs = append(errs, fmt.Errorf("%s or %s is required for the %s mode", cfg.AuthJwtIssuer.Name, cfg.AuthJwtJwksURL.Name, auth.ModeJWT))
+	}
+
+	if _, err := parseRoleScopes(cfg.AuthRoleScopes.List()); err != nil {
+		errs = append(errs, fmt.Errorf("%s (%s) %w", cfg.AuthRoleScopes.Name, cfg.AuthRoleScopes.Key, err))
+	}
+
+	if cfg.RateLimitPerMinute.Int() < 0 || cfg.RateLimitBurst.Int() < 0 {
+		errs = append(errs, fmt.Errorf("%s and %s cannot be negative", cfg.RateLimitPerMinute.Name, cfg.RateLimitBurst.Name))
+	}
+	if _, err := parseRouteCosts(cfg.RateLimitRouteCosts.List()); err != nil {
+		errs = append(errs, fmt.Errorf("%s (%s) %w", cfg.RateLimitRouteCosts.Name, cfg.RateLimitRouteCosts.Key, err))
+	}
+
+	if cfg.DistanceMatrixMax.parsed != nil && cfg.DistanceMatrixMax.Int() < 2 {
+		errs = append(errs, fmt.Errorf("%s must be at least 2", cfg.DistanceMatrixMax.Name))
+	}
+
+	if cfg.PgPoolMaxConns.parsed != nil && cfg.PgPoolMaxConns.Int() < 1 {
+		errs = append(errs, fmt.Errorf("%s must be at least 1", cfg.PgPoolMaxConns.Name))
+	}
+	if cfg.PgPoolMinConns.Int() < 0 || cfg.PgPoolMinConns.Int() > cfg.PgPoolMaxConns.Int() {
+		errs = append(errs, fmt.Errorf("%s must be between 0 and %s", cfg.PgPoolMinConns.Name, cfg.PgPoolMaxConns.Name))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// RouteStatementTimeouts returns the statement timeouts by route template,
+// for example /api/v1/cities for /api/v1/cities=10s.
+func (c *Config) RouteStatementTimeouts() map[string]time.Duration {
+	timeouts, _ := parseRouteTimeouts(c.DbRouteTimeouts.List())
+	return timeouts
+}
+
+func parseRouteTimeouts(list []string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, entry := range list {
+		route, value, ok := strings.Cut(entry, "=")
+		timeout, err := time.ParseDuration(value)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("must be a list of route=duration, got %q", entry)
+		}
+		timeouts["/"+strings.TrimPrefix(route, "/")] = timeout
+	}
+	return timeouts, nil
+}
+
+// RoleScopes returns the scopes granted by the roles of a token, for
+// example atlas-steward for atlas-steward=atlas:read atlas:write.
+func (c *Config) RoleScopes() map[string][]string {
+	roleScopes, _ := parseRoleScopes(c.AuthRoleScopes.List())
+	return roleScopes
+}
+
+func parseRoleScopes(list []string) (map[string][]string, error) {
+	roleScopes := map[string][]string{}
+	for _, entry := range list {
+		role, scopes, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(role) == "" || len(strings.Fields(scopes)) == 0 {
+			return nil, fmt.Errorf("must be a list of role=scope scope, got %q", entry)
+		}
+		roleScopes[strings.TrimSpace(role)] = strings.Fields(scopes)
+	}
+	return roleScopes, nil
+}
+
+// RateLimit returns the token bucket of every client. It is zero when the
+// rate limiting is off, and the burst defaults to the requests per minute.
+func (c *Config) RateLimit() ratelimit.Limit {
+	perMinute := c.RateLimitPerMinute.Int()
+	burst := c.RateLimitBurst.Int()
+	if burst == 0 {
+		burst = perMinute
+	}
+	if perMinute == 0 {
+		return ratelimit.Limit{}
+	}
+	return ratelimit.Limit{Rate: float64(perMinute) / 60, Burst: burst}
+}
+
+// RouteCosts returns the tokens taken by a request by route template, for
+// example /api/v1/cities for /api/v1/cities=5. Other routes cost 1.
+func (c *Config) RouteCosts() map[string]int {
+	costs, _ := parseRouteCosts(c.RateLimitRouteCosts.List())
+	return costs
+}
+
+func parseRouteCosts(list []string) (map[string]int, error) {
+	costs := map[string]int{}
+	for _, entry := range list {
+		route, value, ok := strings.Cut(entry, "=")
+		cost, err := strconv.Atoi(value)
+		if !ok || err != nil || cost < 1 {
+			return nil, fmt.Errorf("must be a list of route=cost with a positive cost, got %q", entry)
+		}
+		costs["/"+strings.TrimPrefix(route, "/")] = cost
+	}
+	return costs, nil
+}
+
+// PgxPool returns the underlying pool for the operations which need a
+// dedicated connection or a transaction.
+func (c *Config) PgxPool() (*pgxpool.Pool, error) {
+	wrapper, ok := c.PgPool.(*PgxPoolWrapper)
+	if !ok {
+		return nil, fmt.Errorf("database is not a PostgreSQL connection pool")
+	}
+	return wrapper.Pool, nil
+}
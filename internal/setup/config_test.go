@@ -0,0 +1,307 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setRequiredEnvs(t *testing.T) {
+	t.Setenv("PG_HOSTNAME", "postgres")
+	t.Setenv("PG_DATABASE", "atlas")
+	t.Setenv("PG_USERNAME", "api")
+	t.Setenv("PG_PASSWORD", "api")
+}
+
+func TestLoadItemsDefaults(t *testing.T) {
+	setRequiredEnvs(t)
+	boundFlags = nil
+
+	var cfg Config
+	if err := loadItems(&cfg); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.ServerAddress.Value != "0.0.0.0:8080" || cfg.ServerAddress.Source != SourceDefault {
+		t.Errorf("Expected default server address, but got '%s' from %s", cfg.ServerAddress.Value, cfg.ServerAddress.Source)
+	}
+	if cfg.ShutdownTimeout.Duration() != 5*time.Second {
+		t.Errorf("Expected shutdown timeout 5s, but got %v", cfg.ShutdownTimeout.Duration())
+	}
+	if cfg.PgPort.Int() != 5432 {
+		t.Errorf("Expected port 5432, but got %d", cfg.PgPort.Int())
+	}
+}
+
+func TestLoadItemsLayers(t *testing.T) {
+	setRequiredEnvs(t)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "server:\n  address: 127.0.0.1:9000\n  shutdown_timeout: 20s\npg:\n  pool:\n    max_conns: 20\ncors:\n  allowed_origins: [https://a.example, https://b.example]\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	t.Setenv("SERVER_SHUTDOWN_TIMEOUT", "30s")
+	t.Setenv("PG_POOL_MAX_CONNS", "40")
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	BindFlags(flags)
+	defer func() { boundFlags = nil }()
+	if err := flags.Parse([]string{"--config", path, "--pg-pool-max_conns", "50"}); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	var cfg Config
+	if err := loadItems(&cfg); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.ServerAddress.Value != "127.0.0.1:9000" || cfg.ServerAddress.Source != SourceFile {
+		t.Errorf("Expected server address from file, but got '%s' from %s", cfg.ServerAddress.Value, cfg.ServerAddress.Source)
+	}
+	if cfg.ShutdownTimeout.Duration() != 30*time.Second || cfg.ShutdownTimeout.Source != SourceEnv {
+		t.Errorf("Expected shutdown timeout from env, but got %v from %s", cfg.ShutdownTimeout.Duration(), cfg.ShutdownTimeout.Source)
+	}
+	if cfg.PgPoolMaxConns.Int() != 50 || cfg.PgPoolMaxConns.Source != SourceFlag {
+		t.Errorf("Expected max conns from flag, but got %d from %s", cfg.PgPoolMaxConns.Int(), cfg.PgPoolMaxConns.Source)
+	}
+	if origins := cfg.CorsAllowedOrigins.List(); len(origins) != 2 || origins[1] != "https://b.example" {
+		t.Errorf("Expected two CORS origins, but got %v", origins)
+	}
+}
+
+func TestLoadItemsAggregatesErrors(t *testing.T) {
+	t.Setenv("PG_HOSTNAME", "")
+	t.Setenv("PG_DATABASE", "atlas")
+	t.Setenv("PG_USERNAME", "api")
+	t.Setenv("PG_PASSWORD", "hunter2")
+	t.Setenv("PG_PORT", "abc")
+	t.Setenv("SERVER_READ_TIMEOUT", "soon")
+	t.Setenv("LOG_LEVEL", "loud")
+	boundFlags = nil
+
+	var cfg Config
+	err := loadItems(&cfg)
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+
+	for _, name := range []string{"PG_HOSTNAME", "PG_PORT", "SERVER_READ_TIMEOUT", "LOG_LEVEL"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected the error to report %s, but got: %v", name, err)
+		}
+	}
+}
+
+func TestSecretItemIsMasked(t *testing.T) {
+	item := ConfigItem{Name: "PG_PASSWORD", Value: "hunter2", Secret: true}
+	if item.String() == "hunter2" {
+		t.Errorf("Expected the secret to be masked")
+	}
+}
+
+func TestPasswordFile(t *testing.T) {
+	setRequiredEnvs(t)
+	boundFlags = nil
+
+	path := filepath.Join(t.TempDir(), "pg_password")
+	if err := os.WriteFile(path, []byte("p@ss:/word#1\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+	t.Setenv("PG_PASSWORD", "")
+	t.Setenv("PG_PASSWORD_FILE", path)
+
+	var cfg Config
+	if err := loadItems(&cfg); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	poolConfig, err := newPoolConfig(&cfg)
+	if err != nil {
+		t.Fatalf("Failed to create pool config: %v", err)
+	}
+	if poolConfig.ConnConfig.User != "api" || poolConfig.ConnConfig.Database != "atlas" {
+		t.Errorf("Expected user api and database atlas, but got %s and %s", poolConfig.ConnConfig.User, poolConfig.ConnConfig.Database)
+	}
+
+	connConfig := poolConfig.ConnConfig.Copy()
+	if err := poolConfig.BeforeConnect(context.Background(), connConfig); err != nil {
+		t.Fatalf("Failed to read password: %v", err)
+	}
+	if connConfig.Password != "p@ss:/word#1" {
+		t.Errorf("Expected the password from the file, but got '%s'", connConfig.Password)
+	}
+
+	if err := os.WriteFile(path, []byte("rotated\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+	if err := poolConfig.BeforeConnect(context.Background(), connConfig); err != nil {
+		t.Fatalf("Failed to read password: %v", err)
+	}
+	if connConfig.Password != "rotated" {
+		t.Errorf("Expected the rotated password, but got '%s'", connConfig.Password)
+	}
+}
+
+func TestPasswordWithSpecialCharacters(t *testing.T) {
+	setRequiredEnvs(t)
+	boundFlags = nil
+	t.Setenv("PG_PASSWORD", "p@ss:/word#1?")
+
+	var cfg Config
+	if err := loadItems(&cfg); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	poolConfig, err := newPoolConfig(&cfg)
+	if err != nil {
+		t.Fatalf("Failed to create pool config: %v", err)
+	}
+	if poolConfig.ConnConfig.Password != "p@ss:/word#1?" || poolConfig.ConnConfig.Host != "postgres" {
+		t.Errorf("Expected the password and host to be kept, but got '%s' and '%s'", poolConfig.ConnConfig.Password, poolConfig.ConnConfig.Host)
+	}
+	if strings.Contains(connectionURL(&cfg).String(), "word") {
+		t.Errorf("Expected the connection URL to leave out the password")
+	}
+	if strings.Contains(fmt.Sprintf("%v %#v", cfg.PgPassword, cfg.PgPassword), "word") {
+		t.Errorf("Expected the password to be masked")
+	}
+}
+
+func TestPasswordRequired(t *testing.T) {
+	setRequiredEnvs(t)
+	boundFlags = nil
+	t.Setenv("PG_PASSWORD", "")
+
+	var cfg Config
+	err := loadItems(&cfg)
+	if err == nil || !strings.Contains(err.Error(), "PG_PASSWORD_FILE") {
+		t.Errorf("Expected a missing password error, but got %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var cfg Config
+	defineItems(&cfg)
+	cfg.DbConnectBackoff.set("1ms", SourceDefault)
+	cfg.DbConnectMaxBackoff.set("4ms", SourceDefault)
+	cfg.DbConnectBackoff.parse()
+	cfg.DbConnectMaxBackoff.parse()
+
+	attempts := 0
+	err := retry(context.Background(), &cfg, time.Second, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected success after 3 attempts, but got %d attempts and %v", attempts, err)
+	}
+
+	err = retry(context.Background(), &cfg, 20*time.Millisecond, func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("Expected the last error after the timeout, but got %v", err)
+	}
+}
+
+func TestConnectMaxBackoff(t *testing.T) {
+	setRequiredEnvs(t)
+	boundFlags = nil
+
+	var cfg Config
+	for _, maxBackoff := range []string{"0s", "100ms"} {
+		t.Setenv("DB_CONNECT_MAX_BACKOFF", maxBackoff)
+		if err := loadItems(&cfg); err == nil || !strings.Contains(err.Error(), "DB_CONNECT_MAX_BACKOFF must be at least DB_CONNECT_BACKOFF") {
+			t.Errorf("Expected an invalid max backoff error for %s, but got %v", maxBackoff, err)
+		}
+	}
+
+	t.Setenv("DB_CONNECT_MAX_BACKOFF", "500ms")
+	if err := loadItems(&cfg); err != nil {
+		t.Errorf("Expected the max backoff to equal the backoff, but got %v", err)
+	}
+}
+
+func TestRouteStatementTimeouts(t *testing.T) {
+	setRequiredEnvs(t)
+	boundFlags = nil
+	t.Setenv("DB_ROUTE_STATEMENT_TIMEOUTS", "api/v1/cities=10s, /api/v1/countries=2s")
+
+	var cfg Config
+	if err := loadItems(&cfg); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	timeouts := cfg.RouteStatementTimeouts()
+	if timeouts["/api/v1/cities"] != 10*time.Second || timeouts["/api/v1/countries"] != 2*time.Second {
+		t.Errorf("Expected the route timeouts, but got %v", timeouts)
+	}
+
+	t.Setenv("DB_ROUTE_STATEMENT_TIMEOUTS", "/api/v1/cities")
+	if err := loadItems(&cfg); err == nil || !strings.Contains(err.Error(), "DB_ROUTE_STATEMENT_TIMEOUTS") {
+		t.Errorf("Expected an invalid route timeout error, but got %v", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	setRequiredEnvs(t)
+	boundFlags = nil
+
+	var cfg Config
+	if err := loadItems(&cfg); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if limit := cfg.RateLimit(); limit.Burst != 0 {
+		t.Errorf("Expected the rate limiting to be off by default, but got %+v", limit)
+	}
+
+	t.Setenv("RATE_LIMIT_PER_MINUTE", "120")
+	t.Setenv("RATE_LIMIT_ROUTE_COSTS", "api/v1/cities=5")
+	if err := loadItems(&cfg); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if limit := cfg.RateLimit(); limit.Rate != 2 || limit.Burst != 120 {
+		t.Errorf("Expected 2 tokens per second and a burst of 120, but got %+v", limit)
+	}
+	if costs := cfg.RouteCosts(); costs["/api/v1/cities"] != 5 {
+		t.Errorf("Expected the route costs, but got %v", costs)
+	}
+
+	t.Setenv("RATE_LIMIT_ROUTE_COSTS", "/api/v1/cities=0")
+	if err := loadItems(&cfg); err == nil || !strings.Contains(err.Error(), "RATE_LIMIT_ROUTE_COSTS") {
+		t.Errorf("Expected an invalid route cost error, but got %v", err)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	setRequiredEnvs(t)
+	boundFlags = nil
+
+	var cfg Config
+	if err := loadItems(&cfg); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if proxies := cfg.TrustedProxies.List(); len(proxies) != 0 {
+		t.Errorf("Expected no trusted proxies by default, but got %v", proxies)
+	}
+
+	t.Setenv("SERVER_TRUSTED_PROXIES", "10.0.0.0/8,192.0.2.1")
+	if err := loadItems(&cfg); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	t.Setenv("SERVER_TRUSTED_PROXIES", "10.0.0.0/33")
+	if err := loadItems(&cfg); err == nil || !strings.Contains(err.Error(), "SERVER_TRUSTED_PROXIES") {
+		t.Errorf("Expected an invalid proxy error, but got %v", err)
+	}
+}
@@ -3,12 +3,22 @@ package setup
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"time"
 
+	"example.com/api/internal/tracing"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// attemptTimeout limits a single connection attempt, so an unreachable host
+// does not use up the whole DB_CONNECT_TIMEOUT.
+const attemptTimeout = 5 * time.Second
+
 type DBPool interface {
 	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
 	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
@@ -16,21 +26,115 @@ type DBPool interface {
 }
 
 func initializeDatabase(cfg *Config) error {
-	pgConnectionurl := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s",
-		cfg.PgUsername.Value,
-		cfg.PgPassword.Value,
-		cfg.PgHostname.Value,
-		cfg.PgPort.Value,
-		cfg.PgDatabase.Value,
-	)
-
-	fmt.Println(pgConnectionurl)
-
-	pool, err := pgxpool.New(context.Background(), pgConnectionurl)
+	poolConfig, err := newPoolConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Connecting to the database", "url", connectionURL(cfg).Redacted())
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return err
 	}
 	cfg.PgPool = &PgxPoolWrapper{Pool: pool}
 	return nil
 }
+
+// connectionURL is the DSN without the password, so the special characters
+// in the other items are escaped and the URL is safe to log.
+func connectionURL(cfg *Config) *url.URL {
+	return &url.URL{
+		Scheme: "postgres",
+		User:   url.User(cfg.PgUsername.Value),
+		Host:   net.JoinHostPort(cfg.PgHostname.Value, cfg.PgPort.Value),
+		Path:   "/" + cfg.PgDatabase.Value,
+	}
+}
+
+// newPoolConfig sets the password on the connection config instead of the
+// URL. A password file is read again for every new connection, so a rotated
+// password is used once the old connections reach their maximum lifetime.
+func newPoolConfig(cfg *Config) (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(connectionURL(cfg).String())
+	if err != nil {
+		return nil, err
+	}
+	poolConfig.MaxConns = int32(cfg.PgPoolMaxConns.Int())
+	poolConfig.MinConns = int32(cfg.PgPoolMinConns.Int())
+	poolConfig.MaxConnLifetime = cfg.PgPoolMaxConnLifetime.Duration()
+	poolConfig.ConnConfig.Tracer = tracing.QueryTracer{}
+
+	if path := cfg.PgPasswordFile.Value; path != "" {
+		poolConfig.BeforeConnect = func(ctx context.Context, connConfig *pgx.ConnConfig) error {
+			password, err := readSecretFile(path)
+			if err != nil {
+				return err
+			}
+			connConfig.Password = password
+			return nil
+		}
+	} else {
+		poolConfig.ConnConfig.Password = cfg.PgPassword.Value
+	}
+
+	return poolConfig, nil
+}
+
+// connectDatabase creates the pool and waits until the database answers,
+// because the pool itself connects lazily. It fails if the database is not
+// reachable within DB_CONNECT_TIMEOUT.
+func connectDatabase(cfg *Config) error {
+	initDbErr := initializeDatabase(cfg)
+	if initDbErr != nil {
+		return initDbErr
+	}
+
+	return retry(context.Background(), cfg, cfg.DbConnectTimeout.Duration(), func(ctx context.Context) error {
+		return pingDatabase(ctx, cfg)
+	})
+}
+
+func pingDatabase(ctx context.Context, cfg *Config) error {
+	pool, err := cfg.PgxPool()
+	if err != nil {
+		return err
+	}
+	return pool.Ping(ctx)
+}
+
+// retry calls fn until it succeeds, with an exponential backoff from
+// DB_CONNECT_BACKOFF up to DB_CONNECT_MAX_BACKOFF, and a random jitter of up
+// to half of the backoff so the replicas do not retry in lockstep. A zero
+// timeout retries forever.
+func retry(ctx context.Context, cfg *Config, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	backoff := cfg.DbConnectBackoff.Duration()
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		err := fn(attemptCtx)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				slog.Info("Connected to the database", "attempts", attempt)
+			}
+			return nil
+		}
+
+		wait := backoff/2 + rand.N(backoff/2+1)
+		slog.Warn("Database is not ready", "attempt", attempt, "error", err, "retry_in", wait.Round(time.Millisecond).String())
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database is not ready after %d attempts in %v: %w", attempt, timeout, err)
+		case <-time.After(wait):
+		}
+
+		backoff = min(backoff*2, cfg.DbConnectMaxBackoff.Duration())
+	}
+}
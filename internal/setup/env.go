@@ -1,31 +1,13 @@
 package setup
 
 import (
-	"fmt"
 	"os"
 )
 
-func getEnvs(cfg *Config) error {
-	cfg.PgHostname.Name = "PG_HOSTNAME"
-	cfg.PgPort.Name = "PG_PORT"
-	cfg.PgDatabase.Name = "PG_DATABASE"
-	cfg.PgUsername.Name = "PG_USERNAME"
-	cfg.PgPassword.Name = "PG_PASSWORD"
-
-	configs := [5]*ConfigItem{
-		&cfg.PgHostname,
-		&cfg.PgPort,
-		&cfg.PgDatabase,
-		&cfg.PgUsername,
-		&cfg.PgPassword,
-	}
-
-	for _, c := range configs {
-		c.Value = os.Getenv(c.Name)
-		if c.Value == "" {
-			return fmt.Errorf("environment variable %s is not defined or it is empty", c.Name)
+func getEnvs(cfg *Config) {
+	for _, c := range cfg.items() {
+		if value, ok := os.LookupEnv(c.Name); ok && value != "" {
+			c.set(value, SourceEnv)
 		}
 	}
-
-	return nil
 }
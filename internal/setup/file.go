@@ -0,0 +1,97 @@
+package setup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// readConfigFile applies the configuration file given with --config or
+// CONFIG_FILE. The nested keys of the file match the item keys, for example
+// server.address is
+//
+//	server:
+//	  address: 0.0.0.0:8080
+func readConfigFile(cfg *Config) error {
+	path := configFlag()
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read configuration file: %w", err)
+	}
+
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	case ".toml":
+		err = toml.Unmarshal(content, &values)
+	default:
+		return fmt.Errorf("configuration file %s must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot parse configuration file %s: %w", path, err)
+	}
+
+	flat := map[string]string{}
+	flatten("", values, flat)
+
+	byKey := map[string]*ConfigItem{}
+	for _, item := range cfg.items() {
+		byKey[item.Key] = item
+	}
+
+	var errs []error
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		item, ok := byKey[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown key %s", key))
+			continue
+		}
+		item.set(flat[key], SourceFile)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration file %s:\n%w", path, errors.Join(errs...))
+	}
+	return nil
+}
+
+func flatten(prefix string, values map[string]any, flat map[string]string) {
+	for key, value := range values {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			flatten(key, v, flat)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			flat[key] = strings.Join(items, ",")
+		case nil:
+			flat[key] = ""
+		default:
+			flat[key] = fmt.Sprint(v)
+		}
+	}
+}
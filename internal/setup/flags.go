@@ -0,0 +1,60 @@
+package setup
+
+import (
+	"flag"
+)
+
+var boundFlags *flag.FlagSet
+
+// BindFlags registers the --config flag and a flag for every configuration
+// item on the command's flag set. The flags which are set on the command
+// line override all other layers when the configuration is loaded. The
+// secrets have no flags, because the command line is visible to every user
+// of the host.
+func BindFlags(flags *flag.FlagSet) {
+	var items Config
+	defineItems(&items)
+
+	flags.String("config", "", "configuration file in yaml or toml (env CONFIG_FILE)")
+	for _, item := range items.items() {
+		if item.Secret {
+			continue
+		}
+		usage := "env " + item.Name
+		if item.Default != "" {
+			usage += ", default " + item.Default
+		}
+		flags.String(item.FlagName(), "", usage)
+	}
+
+	boundFlags = flags
+}
+
+func getFlags(cfg *Config) {
+	if boundFlags == nil {
+		return
+	}
+
+	byFlag := map[string]*ConfigItem{}
+	for _, item := range cfg.items() {
+		if !item.Secret {
+			byFlag[item.FlagName()] = item
+		}
+	}
+
+	boundFlags.Visit(func(f *flag.Flag) {
+		if item, ok := byFlag[f.Name]; ok {
+			item.set(f.Value.String(), SourceFlag)
+		}
+	})
+}
+
+func configFlag() string {
+	if boundFlags == nil {
+		return ""
+	}
+	if f := boundFlags.Lookup("config"); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
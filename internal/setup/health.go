@@ -0,0 +1,71 @@
+package setup
+
+import (
+	"context"
+	"sync/atomic"
+
+	"example.com/api/internal/migrations"
+)
+
+// Health is the state of the process which the readiness endpoint reports
+// in addition to the dependency checks.
+type Health struct {
+	starting atomic.Bool
+	draining atomic.Bool
+}
+
+// Starting is true while the server waits for the database in the degraded
+// mode.
+func (h *Health) Starting() bool {
+	return h.starting.Load()
+}
+
+func (h *Health) SetStarting(starting bool) {
+	h.starting.Store(starting)
+}
+
+// Drain makes the readiness fail, so the load balancers stop sending new
+// requests before the server shuts down.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+func (h *Health) Draining() bool {
+	return h.draining.Load()
+}
+
+// HealthCheck checks a dependency of the API. The details are added to the
+// health report.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) (map[string]any, error)
+}
+
+// HealthChecks returns the checks which must pass for the API to be ready:
+// the database answers a ping, and its schema has no pending migrations.
+func (c *Config) HealthChecks() []HealthCheck {
+	return []HealthCheck{
+		{Name: "database", Check: func(ctx context.Context) (map[string]any, error) {
+			pool, err := c.PgxPool()
+			if err != nil {
+				return nil, err
+			}
+
+			stat := pool.Stat()
+			details := map[string]any{
+				"total_conns":    stat.TotalConns(),
+				"idle_conns":     stat.IdleConns(),
+				"acquired_conns": stat.AcquiredConns(),
+				"max_conns":      stat.MaxConns(),
+			}
+			return details, pool.Ping(ctx)
+		}},
+		{Name: "migrations", Check: func(ctx context.Context) (map[string]any, error) {
+			pool, err := c.PgxPool()
+			if err != nil {
+				return nil, err
+			}
+			return nil, migrations.Check(ctx, pool)
+		}},
+	}
+}
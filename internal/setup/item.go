@@ -0,0 +1,140 @@
+package setup
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ItemKind int
+
+const (
+	KindString ItemKind = iota
+	KindInt
+	KindDuration
+	KindBool
+	KindList
+)
+
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// ConfigItem is a single setting. It is read from the configuration file
+// with Key, from the environment with Name, and from the command line with
+// the flag name derived from Key.
+type ConfigItem struct {
+	Name     string
+	Key      string
+	Value    string
+	Default  string
+	Kind     ItemKind
+	Required bool
+	Secret   bool
+	Allowed  []string
+	Source   string
+	parsed   any
+}
+
+func (i *ConfigItem) set(value string, source string) {
+	i.Value = value
+	i.Source = source
+}
+
+// FlagName is the command line flag of the item, for example
+// server-address for server.address.
+func (i *ConfigItem) FlagName() string {
+	return strings.ReplaceAll(i.Key, ".", "-")
+}
+
+// String returns the value for logging, masking it if the item is secret.
+func (i ConfigItem) String() string {
+	if i.Secret && i.Value != "" {
+		return "******"
+	}
+	return i.Value
+}
+
+// GoString masks the secret in %#v too.
+func (i ConfigItem) GoString() string {
+	return fmt.Sprintf("setup.ConfigItem{Name:%q, Value:%q, Source:%q}", i.Name, i.String(), i.Source)
+}
+
+func (i *ConfigItem) Int() int {
+	n, _ := i.parsed.(int)
+	return n
+}
+
+func (i *ConfigItem) Duration() time.Duration {
+	d, _ := i.parsed.(time.Duration)
+	return d
+}
+
+func (i *ConfigItem) Bool() bool {
+	b, _ := i.parsed.(bool)
+	return b
+}
+
+func (i *ConfigItem) List() []string {
+	l, _ := i.parsed.([]string)
+	return l
+}
+
+// parse validates the value against the kind and the allowed values, and
+// stores the typed value.
+func (i *ConfigItem) parse() error {
+	if i.Value == "" {
+		if i.Required {
+			return fmt.Errorf("%s (%s) is required", i.Name, i.Key)
+		}
+		i.parsed = nil
+		return nil
+	}
+
+	switch i.Kind {
+	case KindInt:
+		n, err := strconv.Atoi(i.Value)
+		if err != nil {
+			return fmt.Errorf("%s (%s) must be an integer, got %q", i.Name, i.Key, i.String())
+		}
+		i.parsed = n
+	case KindDuration:
+		d, err := time.ParseDuration(i.Value)
+		if err != nil {
+			return fmt.Errorf("%s (%s) must be a duration such as 5s, got %q", i.Name, i.Key, i.String())
+		}
+		i.parsed = d
+	case KindBool:
+		b, err := strconv.ParseBool(i.Value)
+		if err != nil {
+			return fmt.Errorf("%s (%s) must be true or false, got %q", i.Name, i.Key, i.String())
+		}
+		i.parsed = b
+	case KindList:
+		var list []string
+		for _, item := range strings.Split(i.Value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		i.parsed = list
+	default:
+		i.parsed = i.Value
+	}
+
+	values := []string{i.Value}
+	if i.Kind == KindList {
+		values = i.List()
+	}
+	for _, value := range values {
+		if len(i.Allowed) > 0 && !slices.Contains(i.Allowed, value) {
+			return fmt.Errorf("%s (%s) must be one of %s, got %q", i.Name, i.Key, strings.Join(i.Allowed, ", "), i.String())
+		}
+	}
+	return nil
+}
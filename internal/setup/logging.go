@@ -0,0 +1,33 @@
+package setup
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// initializeLogger makes the slog default logger, and with it the log
+// package, write in LOG_FORMAT from LOG_LEVEL up.
+func initializeLogger(cfg *Config) {
+	slog.SetDefault(newLogger(os.Stderr, cfg.LogFormat.Value, cfg.LogLevel.Value))
+}
+
+func newLogger(w io.Writer, format string, level string) *slog.Logger {
+	options := &slog.HandlerOptions{Level: logLevels[level]}
+	if format == LogFormatText {
+		return slog.New(slog.NewTextHandler(w, options))
+	}
+	return slog.New(slog.NewJSONHandler(w, options))
+}
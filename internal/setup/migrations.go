@@ -0,0 +1,39 @@
+package setup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"example.com/api/internal/migrations"
+)
+
+const (
+	MigrationsUp    = "up"
+	MigrationsCheck = "check"
+	MigrationsOff   = "off"
+)
+
+// migrateDatabase applies the pending migrations, or only checks that there
+// are none, depending on DB_MIGRATIONS.
+func migrateDatabase(cfg *Config) error {
+	pool, err := cfg.PgxPool()
+	if err != nil {
+		return err
+	}
+
+	switch cfg.DbMigrations.Value {
+	case MigrationsUp:
+		applied, err := migrations.Up(context.Background(), pool)
+		for _, m := range applied {
+			slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+		}
+		return err
+	case MigrationsCheck:
+		return migrations.Check(context.Background(), pool)
+	case MigrationsOff:
+		return nil
+	default:
+		return fmt.Errorf("environment variable %s must be one of %s, %s or %s", cfg.DbMigrations.Name, MigrationsUp, MigrationsCheck, MigrationsOff)
+	}
+}
@@ -0,0 +1,23 @@
+package setup
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readSecretFile reads a secret which is mounted as a file, such as a
+// Docker or Kubernetes secret. The trailing newline is not part of the
+// secret.
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	secret := strings.TrimRight(string(content), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return secret, nil
+}
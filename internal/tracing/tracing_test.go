@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The global tracer delegates only to the first provider, so the tests
+// share one recorder.
+var recorder = tracetest.NewSpanRecorder()
+
+func TestMain(m *testing.M) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	os.Exit(m.Run())
+}
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	before := len(recorder.Ended())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/api/v1/city/:id", func(c *gin.Context) {
+		_, span := tracer.Start(c.Request.Context(), "SELECT")
+		span.End()
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/city/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()[before:]
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, but got %d", len(spans))
+	}
+
+	query, server := spans[0], spans[1]
+	if server.Name() != "GET /api/v1/city/:id" || server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("Expected a server span for the route, but got '%s'", server.Name())
+	}
+	if server.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected the span to continue the incoming trace")
+	}
+	if query.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("Expected the handler span to be a child of the server span")
+	}
+	if server.Status().Code != codes.Error {
+		t.Errorf("Expected the 500 response to mark the span as failed")
+	}
+}
+
+func TestQueryTracer(t *testing.T) {
+	before := len(recorder.Ended())
+
+	ctx, parent := tracer.Start(context.Background(), "GET /api/v1/cities")
+	var queryTracer QueryTracer
+	queryCtx := queryTracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "\n\tselect id FROM cities"})
+	queryTracer.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{Err: errors.New("canceling statement")})
+	parent.End()
+
+	span := recorder.Ended()[before]
+	if span.Name() != "SELECT" || span.SpanKind() != trace.SpanKindClient {
+		t.Errorf("Expected a client span named SELECT, but got '%s'", span.Name())
+	}
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Expected the query span to be a child of the request span")
+	}
+	if span.Status().Code != codes.Error {
+		t.Errorf("Expected the failed query to mark the span as failed")
+	}
+}
@@ -11,11 +11,12 @@ if [ "${DB_EXISTS}" == 0 ]; then
   psql -U postgres atlas -tAc "GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO api"
   psql -U postgres atlas -tAc "ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT ALL PRIVILEGES ON TABLES TO api"
 
-  psql -U postgres atlas -tAc "CREATE TABLE continents (id SERIAL PRIMARY KEY, name VARCHAR(100) NOT NULL)"
-  psql -U postgres atlas -tAc "CREATE TABLE countries (id SERIAL PRIMARY KEY, name VARCHAR(100) NOT NULL, continent_id INT NOT NULL, FOREIGN KEY (continent_id) REFERENCES continents(id))"
-  psql -U postgres atlas -tAc "CREATE TABLE cities (id SERIAL PRIMARY KEY, name VARCHAR(100) NOT NULL, country_id INT NOT NULL, FOREIGN KEY (country_id) REFERENCES countries(id))"
-
-  psql -U postgres atlas -tAc "GRANT USAGE, SELECT ON SEQUENCE continents_id_seq TO api"
-  psql -U postgres atlas -tAc "GRANT USAGE, SELECT ON SEQUENCE countries_id_seq TO api"
-  psql -U postgres atlas -tAc "GRANT USAGE, SELECT ON SEQUENCE cities_id_seq TO api"
+  # The tables are created by the migrations of the API app.
+else
+  # The volumes created before the migrations have the tables of postgres,
+  # which the migrations of api cannot alter. Running the script again
+  # gives them to api, and the owned id sequences move with the tables.
+  for TABLE in continents countries cities; do
+    psql -U postgres atlas -tAc "ALTER TABLE IF EXISTS ${TABLE} OWNER TO api"
+  done
 fi